@@ -0,0 +1,231 @@
+// Package accesslog records one line per request served, in the Common or
+// Combined Log Format or as JSON.
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"server/errs"
+	"server/logging"
+	"server/requestid"
+)
+
+const (
+	FormatCommon   = "common"
+	FormatCombined = "combined"
+	FormatJSON     = "json"
+)
+
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// Entry is what is known of a request once it has been served.
+type Entry struct {
+	Time      time.Time
+	RequestID string
+	ClientIP  string
+	UserID    int
+	Method    string
+	Route     string
+	URI       string
+	Proto     string
+	Status    int
+	Bytes     int64
+	Latency   time.Duration
+	Referer   string
+	UserAgent string
+}
+
+type Logger struct {
+	format  string
+	proxies TrustedProxies
+
+	mu     sync.Mutex
+	output io.Writer
+}
+
+func New(output io.Writer, format string, proxies TrustedProxies) (*Logger, error) {
+	switch format {
+	case FormatCommon, FormatCombined, FormatJSON:
+	default:
+		return nil, fmt.Errorf("%s: %q", errs.UnknownAccessLogFormatError, format)
+	}
+
+	return &Logger{format: format, proxies: proxies, output: output}, nil
+}
+
+// responseRecorder captures the status and size of the response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if r.status == 0 {
+		r.status = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Middleware logs the requests served by next under route, the pattern
+// next is registered for. It must run inside logging.Middleware to know the
+// user of the request.
+func (l *Logger) Middleware(route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &responseRecorder{ResponseWriter: w}
+
+			// a handler that panics past the recovery middleware is logged
+			// as a 500 before the panic goes on
+			defer func() {
+				p := recover()
+
+				status := recorder.status
+				if status == 0 {
+					status = http.StatusOK
+					if p != nil {
+						status = http.StatusInternalServerError
+					}
+				}
+
+				l.Log(Entry{
+					Time:      start,
+					RequestID: requestid.FromContext(r.Context()),
+					ClientIP:  l.proxies.ClientIP(r),
+					UserID:    logging.UserID(r.Context()),
+					Method:    r.Method,
+					Route:     route,
+					URI:       r.RequestURI,
+					Proto:     r.Proto,
+					Status:    status,
+					Bytes:     recorder.bytes,
+					Latency:   time.Since(start),
+					Referer:   r.Referer(),
+					UserAgent: r.UserAgent(),
+				})
+
+				if p != nil {
+					panic(p)
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+		})
+	}
+}
+
+func (l *Logger) Log(entry Entry) {
+	var line []byte
+
+	switch l.format {
+	case FormatJSON:
+		line = formatJSON(entry)
+	default:
+		line = formatCLF(entry, l.format == FormatCombined)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.output.Write(line); err != nil {
+		slog.Error("writing the access log failed", "error", err)
+	}
+}
+
+// formatCLF writes the fields of the format only, so that the usual tools
+// can parse the lines; the route and latency are in the JSON format.
+func formatCLF(entry Entry, combined bool) []byte {
+	var builder strings.Builder
+
+	user := "-"
+	if entry.UserID != 0 {
+		user = strconv.Itoa(entry.UserID)
+	}
+
+	size := "-"
+	if entry.Bytes > 0 {
+		size = strconv.FormatInt(entry.Bytes, 10)
+	}
+
+	fmt.Fprintf(&builder, "%s - %s [%s] \"%s %s %s\" %d %s",
+		entry.ClientIP, user, entry.Time.Format(clfTimeLayout),
+		entry.Method, escape(entry.URI), entry.Proto, entry.Status, size)
+
+	if combined {
+		fmt.Fprintf(&builder, " \"%s\" \"%s\"", escape(orDash(entry.Referer)), escape(orDash(entry.UserAgent)))
+	}
+
+	builder.WriteByte('\n')
+	return []byte(builder.String())
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// escape keeps the client from breaking the quoted fields or the line.
+func escape(value string) string {
+	quoted := strconv.Quote(value)
+	return quoted[1 : len(quoted)-1]
+}
+
+type jsonEntry struct {
+	Time      string  `json:"time"`
+	RequestID string  `json:"request_id,omitempty"`
+	ClientIP  string  `json:"client_ip"`
+	UserID    int     `json:"user_id,omitempty"`
+	Method    string  `json:"method"`
+	Route     string  `json:"route"`
+	URI       string  `json:"uri"`
+	Proto     string  `json:"proto"`
+	Status    int     `json:"status"`
+	Bytes     int64   `json:"bytes"`
+	LatencyMS float64 `json:"latency_ms"`
+	Referer   string  `json:"referer,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty"`
+}
+
+func formatJSON(entry Entry) []byte {
+	line, _ := json.Marshal(jsonEntry{
+		Time:      entry.Time.Format(time.RFC3339Nano),
+		RequestID: entry.RequestID,
+		ClientIP:  entry.ClientIP,
+		UserID:    entry.UserID,
+		Method:    entry.Method,
+		Route:     entry.Route,
+		URI:       entry.URI,
+		Proto:     entry.Proto,
+		Status:    entry.Status,
+		Bytes:     entry.Bytes,
+		LatencyMS: float64(entry.Latency.Microseconds()) / 1000,
+		Referer:   entry.Referer,
+		UserAgent: entry.UserAgent,
+	})
+
+	return append(line, '\n')
+}
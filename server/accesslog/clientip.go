@@ -0,0 +1,87 @@
+package accesslog
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"server/errs"
+)
+
+// TrustedProxies are the addresses allowed to tell the client address of
+// the requests they forward, in the X-Forwarded-For header.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies reads addresses such as "10.0.0.1" and networks such
+// as "10.0.0.0/8".
+func ParseTrustedProxies(values []string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(values))
+
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q", errs.InvalidProxyAddressError, value)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q", errs.InvalidProxyAddressError, value)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+
+	return proxies, nil
+}
+
+func (t TrustedProxies) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	for _, prefix := range t {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClientIP returns the address of the client of r. The X-Forwarded-For
+// header is only read when the request comes from a trusted proxy, from
+// right to left, and the first address not trusted is the client: the
+// entries on its left were written by the client itself and can be forged.
+func (t TrustedProxies) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !t.contains(remote) {
+		return host
+	}
+
+	client := remote
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+
+		client = addr
+		if !t.contains(addr) {
+			break
+		}
+	}
+
+	return client.Unmap().String()
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log/slog"
+	"os"
+)
+
+//go:embed views public
+var embeddedAssets embed.FS
+
+// assetsFileSystem returns the embedded views and public assets, or dir
+// when set so they can be edited without rebuilding the binary.
+func assetsFileSystem(dir string) fs.FS {
+	if dir != "" {
+		slog.Info("serving views and static assets from disk", "dir", dir)
+		return os.DirFS(dir)
+	}
+
+	return embeddedAssets
+}
@@ -0,0 +1,302 @@
+// Package config builds the settings of the server from, in increasing
+// order of precedence:
+//
+//  1. the defaults of Default,
+//  2. a YAML file, named by the -config flag or the CONFIG_FILE variable,
+//     or config.yaml in the working directory when it exists; a file named
+//     with the .toml extension is read as TOML, with the same keys,
+//  3. environment variables, including those of a .env file, which never
+//     replace variables already set; empty variables are ignored. As they
+//     override the file, .env should only hold secrets,
+//  4. command-line flags.
+//
+// Every setting has a yaml key, an env variable and optionally a flag,
+// declared with the struct tags of its field. Fields tagged secret are
+// redacted when the configuration is printed.
+package config
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"server/accesslog"
+	"server/db"
+	"server/logging"
+	"server/password"
+	"server/phone"
+)
+
+type ServerConfig struct {
+	Addr      string `yaml:"addr" env:"SERVER_ADDR" flag:"addr" usage:"address the HTTP server listens on"`
+	DevMode   bool   `yaml:"dev_mode" env:"DEV_MODE" flag:"dev" usage:"reload views when they change, requires assets_dir"`
+	AssetsDir string `yaml:"assets_dir" env:"ASSETS_DIR" flag:"assets-dir" usage:"serve views and public assets from this directory instead of the embedded ones"`
+	// InsecureAdmin opens the admin routes to requests without an admin
+	// client certificate. It is refused outside dev mode.
+	InsecureAdmin bool `yaml:"insecure_admin" env:"SERVER_INSECURE_ADMIN" usage:"serve the admin routes without a client certificate, dev mode only"`
+
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT" usage:"time allowed to read a whole request"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT" usage:"time allowed to read the request headers"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" usage:"time allowed to write a response"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" usage:"time a keep-alive connection may stay idle"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" usage:"time allowed to drain requests and release resources on shutdown"`
+	TrustedProxies    []string      `yaml:"trusted_proxies" env:"SERVER_TRUSTED_PROXIES" usage:"comma separated addresses or networks of the proxies whose X-Forwarded-For header is trusted"`
+}
+
+type LogConfig struct {
+	Level     string `yaml:"level" env:"LOG_LEVEL" flag:"log-level" usage:"debug, info, warn or error"`
+	Format    string `yaml:"format" env:"LOG_FORMAT" flag:"log-format" usage:"text or json"`
+	AddSource bool   `yaml:"add_source" env:"LOG_ADD_SOURCE" usage:"add the source file and line of the call to the records"`
+}
+
+// AccessLogConfig writes one line per request to Output, "stdout",
+// "stderr" or a file path, or nowhere when it is empty.
+type AccessLogConfig struct {
+	Output     string `yaml:"output" env:"ACCESS_LOG_OUTPUT" flag:"access-log" usage:"stdout, stderr or a file path, disabled when empty"`
+	Format     string `yaml:"format" env:"ACCESS_LOG_FORMAT" usage:"common, combined or json"`
+	MaxSize    int    `yaml:"max_size" env:"ACCESS_LOG_MAX_SIZE" usage:"size in MB past which the file is rotated, never when 0"`
+	MaxBackups int    `yaml:"max_backups" env:"ACCESS_LOG_MAX_BACKUPS" usage:"rotated files kept"`
+}
+
+// MetricsConfig serves /metrics on Addr, a listener of its own, or on the
+// main server when Addr is empty, where it is an admin route that requires
+// an admin client certificate.
+type MetricsConfig struct {
+	Enabled  bool   `yaml:"enabled" env:"METRICS_ENABLED" flag:"metrics" usage:"serve Prometheus metrics on /metrics"`
+	Addr     string `yaml:"addr" env:"METRICS_ADDR" flag:"metrics-addr" usage:"separate address serving /metrics, the main server when empty"`
+	Username string `yaml:"username" env:"METRICS_USERNAME"`
+	Password string `yaml:"password" env:"METRICS_PASSWORD" secret:"true" usage:"requires basic auth on /metrics when set"`
+}
+
+// TLSConfig enables HTTPS on server.addr when CertFile is set.
+type TLSConfig struct {
+	CertFile              string        `yaml:"cert_file" env:"TLS_CERT_FILE" flag:"tls-cert" usage:"PEM certificate chain served over HTTPS, enables TLS"`
+	KeyFile               string        `yaml:"key_file" env:"TLS_KEY_FILE" flag:"tls-key" usage:"PEM private key of the certificate"`
+	ReloadInterval        time.Duration `yaml:"reload_interval" env:"TLS_RELOAD_INTERVAL" usage:"how often the certificate files are checked for changes"`
+	MinVersion            string        `yaml:"min_version" env:"TLS_MIN_VERSION" usage:"1.2 or 1.3"`
+	CipherSuites          []string      `yaml:"cipher_suites" env:"TLS_CIPHER_SUITES" usage:"comma separated TLS 1.2 cipher suites, Go defaults when empty"`
+	RedirectAddr          string        `yaml:"redirect_addr" env:"TLS_REDIRECT_ADDR" flag:"redirect-addr" usage:"plain HTTP address redirecting to HTTPS, disabled when empty"`
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age" env:"TLS_HSTS_MAX_AGE" usage:"Strict-Transport-Security max-age, disabled when 0"`
+	HSTSIncludeSubdomains bool          `yaml:"hsts_include_subdomains" env:"TLS_HSTS_INCLUDE_SUBDOMAINS"`
+	HSTSPreload           bool          `yaml:"hsts_preload" env:"TLS_HSTS_PRELOAD"`
+	AdminClientCAFile     string        `yaml:"admin_client_ca_file" env:"TLS_ADMIN_CLIENT_CA_FILE" usage:"CAs of the client certificates required on the admin routes, enables mutual TLS"`
+}
+
+func (t *TLSConfig) Enabled() bool {
+	return t.CertFile != ""
+}
+
+type SessionConfig struct {
+	CookieName     string        `yaml:"cookie_name" env:"SESSION_COOKIE_NAME" usage:"name of the session cookie"`
+	CookieLifetime time.Duration `yaml:"cookie_lifetime" env:"SESSION_COOKIE_LIFETIME" usage:"lifetime of the session cookie"`
+	Expiration     time.Duration `yaml:"expiration" env:"SESSION_EXPIRATION" usage:"inactivity after which a session expires"`
+	Secure         bool          `yaml:"secure" env:"SESSION_SECURE" usage:"send the session cookie over HTTPS only"`
+	Domain         string        `yaml:"domain" env:"SESSION_DOMAIN" usage:"domain of the session cookie"`
+}
+
+type LoginConfig struct {
+	MaxAttempts int `yaml:"max_attempts" env:"LOGIN_MAX_ATTEMPTS" flag:"login-max-attempts" usage:"failed logins allowed before the account is locked"`
+}
+
+type DatabaseConfig struct {
+	Host                  string        `yaml:"host" env:"DB_HOST" flag:"db-host"`
+	Port                  string        `yaml:"port" env:"DB_PORT" flag:"db-port"`
+	User                  string        `yaml:"user" env:"DB_USER" flag:"db-user"`
+	Password              string        `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name                  string        `yaml:"name" env:"DB_NAME" flag:"db-name"`
+	QueryTimeout          time.Duration `yaml:"query_timeout" env:"DB_QUERY_TIMEOUT"`
+	SlowQueryThreshold    time.Duration `yaml:"slow_query_threshold" env:"DB_SLOW_QUERY_THRESHOLD"`
+	MaxOpenConns          int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns          int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime       time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime       time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	PingAttempts          int           `yaml:"ping_attempts" env:"DB_PING_ATTEMPTS"`
+	PingTimeout           time.Duration `yaml:"ping_timeout" env:"DB_PING_TIMEOUT"`
+	Replicas              []string      `yaml:"replicas" env:"DB_REPLICAS" usage:"comma separated host:port of the read replicas"`
+	ReplicaHealthInterval time.Duration `yaml:"replica_health_interval" env:"DB_REPLICA_HEALTH_INTERVAL"`
+	ReadYourWritesWindow  time.Duration `yaml:"read_your_writes_window" env:"DB_READ_YOUR_WRITES_WINDOW"`
+}
+
+type PasswordConfig struct {
+	MinLength            int    `yaml:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	MaxLength            int    `yaml:"max_length" env:"PASSWORD_MAX_LENGTH"`
+	RequireLower         bool   `yaml:"require_lower" env:"PASSWORD_REQUIRE_LOWER"`
+	RequireUpper         bool   `yaml:"require_upper" env:"PASSWORD_REQUIRE_UPPER"`
+	RequireDigit         bool   `yaml:"require_digit" env:"PASSWORD_REQUIRE_DIGIT"`
+	RequireSymbol        bool   `yaml:"require_symbol" env:"PASSWORD_REQUIRE_SYMBOL"`
+	DisallowPersonalInfo bool   `yaml:"disallow_personal_info" env:"PASSWORD_DISALLOW_PERSONAL_INFO"`
+	MinScore             int    `yaml:"min_score" env:"PASSWORD_MIN_SCORE"`
+	CommonList           string `yaml:"common_list" env:"PASSWORD_COMMON_LIST" usage:"file of extra common passwords, one per line"`
+	BreachedSource       string `yaml:"breached_source" env:"PASSWORD_BREACHED_SOURCE" usage:"Pwned Passwords file or range directory"`
+	BreachedIndex        string `yaml:"breached_index" env:"PASSWORD_BREACHED_INDEX" usage:"index built from breached_source, defaults to breached_source.idx"`
+	BreachedMinCount     int    `yaml:"breached_min_count" env:"PASSWORD_BREACHED_MIN_COUNT"`
+	HashAlgorithm        string `yaml:"hash_algorithm" env:"PASSWORD_HASH_ALGORITHM" usage:"argon2id or bcrypt"`
+	BcryptCost           int    `yaml:"bcrypt_cost" env:"PASSWORD_BCRYPT_COST"`
+	Argon2Memory         uint32 `yaml:"argon2_memory" env:"PASSWORD_ARGON2_MEMORY" usage:"Argon2id memory in KiB"`
+	Argon2Iterations     uint32 `yaml:"argon2_iterations" env:"PASSWORD_ARGON2_ITERATIONS"`
+	Argon2Parallelism    uint8  `yaml:"argon2_parallelism" env:"PASSWORD_ARGON2_PARALLELISM"`
+}
+
+type PhoneConfig struct {
+	DefaultRegion string `yaml:"default_region" env:"PHONE_DEFAULT_REGION" usage:"region of the phone numbers entered without a country code"`
+}
+
+type SMSConfig struct {
+	Sender       string `yaml:"sender" env:"SMS_SENDER" usage:"log or webhook"`
+	WebhookURL   string `yaml:"webhook_url" env:"SMS_WEBHOOK_URL"`
+	WebhookToken string `yaml:"webhook_token" env:"SMS_WEBHOOK_TOKEN" secret:"true"`
+}
+
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Log       LogConfig       `yaml:"log"`
+	AccessLog AccessLogConfig `yaml:"access_log"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	TLS       TLSConfig       `yaml:"tls"`
+	Session   SessionConfig   `yaml:"session"`
+	Login     LoginConfig     `yaml:"login"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Password  PasswordConfig  `yaml:"password"`
+	Phone     PhoneConfig     `yaml:"phone"`
+	SMS       SMSConfig       `yaml:"sms"`
+
+	// File is the configuration file that was read, if any.
+	File string `yaml:"-"`
+
+	printOnly bool
+}
+
+func Default() *Config {
+	database := db.DefaultConfig()
+	policy := password.DefaultPolicy()
+	argon2id := password.DefaultArgon2idHasher()
+
+	return &Config{
+		Server: ServerConfig{
+			Addr:              ":5000",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: logging.FormatText,
+		},
+		AccessLog: AccessLogConfig{
+			Output:     "stdout",
+			Format:     accesslog.FormatCombined,
+			MaxBackups: 5,
+		},
+		TLS: TLSConfig{
+			ReloadInterval: 30 * time.Second,
+			MinVersion:     "1.2",
+			HSTSMaxAge:     365 * 24 * time.Hour,
+		},
+		Session: SessionConfig{
+			CookieName:     "go_session_id",
+			CookieLifetime: 7 * 24 * time.Hour,
+			Expiration:     2 * time.Hour,
+			Secure:         false,
+		},
+		Login: LoginConfig{
+			MaxAttempts: 2,
+		},
+		Database: DatabaseConfig{
+			Host:                  "localhost",
+			Port:                  "3306",
+			Name:                  "server_db",
+			QueryTimeout:          database.QueryTimeout,
+			SlowQueryThreshold:    database.SlowQueryThreshold,
+			MaxOpenConns:          database.Pool.MaxOpenConns,
+			MaxIdleConns:          database.Pool.MaxIdleConns,
+			ConnMaxLifetime:       database.Pool.ConnMaxLifetime,
+			ConnMaxIdleTime:       database.Pool.ConnMaxIdleTime,
+			PingAttempts:          database.Ping.Attempts,
+			PingTimeout:           database.Ping.Timeout,
+			ReplicaHealthInterval: database.Replication.HealthCheckInterval,
+			ReadYourWritesWindow:  database.Replication.ReadYourWritesWindow,
+		},
+		Password: PasswordConfig{
+			MinLength:            policy.MinLength,
+			MaxLength:            policy.MaxLength,
+			RequireLower:         policy.RequireLower,
+			RequireUpper:         policy.RequireUpper,
+			RequireDigit:         policy.RequireDigit,
+			RequireSymbol:        policy.RequireSymbol,
+			DisallowPersonalInfo: policy.DisallowPersonalInfo,
+			MinScore:             policy.MinScore,
+			BreachedMinCount:     1,
+			HashAlgorithm:        password.AlgorithmArgon2id,
+			BcryptCost:           bcrypt.DefaultCost,
+			Argon2Memory:         argon2id.Memory,
+			Argon2Iterations:     argon2id.Iterations,
+			Argon2Parallelism:    argon2id.Parallelism,
+		},
+		Phone: PhoneConfig{
+			DefaultRegion: phone.DefaultRegion,
+		},
+		SMS: SMSConfig{
+			Sender: "log",
+		},
+	}
+}
+
+// PrintOnly reports whether the -print-config flag asked to print the
+// configuration and exit.
+func (c *Config) PrintOnly() bool {
+	return c.printOnly
+}
+
+// Logging returns the options of the logger. The level must have been
+// checked by Validate.
+func (c *Config) Logging() logging.Options {
+	level, _ := logging.ParseLevel(c.Log.Level)
+
+	return logging.Options{
+		Format:    c.Log.Format,
+		Level:     level,
+		AddSource: c.Log.AddSource,
+	}
+}
+
+// DB returns the settings of the database connector. Replicas must have
+// been checked by Validate.
+func (c *Config) DB() db.Config {
+	config := db.DefaultConfig()
+
+	config.Host = c.Database.Host
+	config.Port = c.Database.Port
+	config.User = c.Database.User
+	config.Password = c.Database.Password
+	config.Database = c.Database.Name
+	config.QueryTimeout = c.Database.QueryTimeout
+	config.SlowQueryThreshold = c.Database.SlowQueryThreshold
+	config.Pool.MaxOpenConns = c.Database.MaxOpenConns
+	config.Pool.MaxIdleConns = c.Database.MaxIdleConns
+	config.Pool.ConnMaxLifetime = c.Database.ConnMaxLifetime
+	config.Pool.ConnMaxIdleTime = c.Database.ConnMaxIdleTime
+	config.Ping.Attempts = c.Database.PingAttempts
+	config.Ping.Timeout = c.Database.PingTimeout
+	config.Replication.HealthCheckInterval = c.Database.ReplicaHealthInterval
+	config.Replication.ReadYourWritesWindow = c.Database.ReadYourWritesWindow
+
+	for _, address := range c.Database.Replicas {
+		host, port, _ := net.SplitHostPort(address)
+		config.Replication.Replicas = append(config.Replication.Replicas, db.ReplicaConfig{Host: host, Port: port})
+	}
+
+	return config
+}
+
+// BreachedIndexPath is the breached password index to open, "" when the
+// check is disabled.
+func (c *Config) BreachedIndexPath() string {
+	if c.Password.BreachedIndex != "" || c.Password.BreachedSource == "" {
+		return c.Password.BreachedIndex
+	}
+	return strings.TrimSuffix(c.Password.BreachedSource, string(filepath.Separator)) + ".idx"
+}
@@ -0,0 +1,347 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+	"server/errs"
+)
+
+const (
+	defaultFile   = "config.yaml"
+	fileEnv       = "CONFIG_FILE"
+	redactedValue = "******"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setting is a leaf field of Config, reached through its yaml keys.
+type setting struct {
+	path  string
+	field reflect.StructField
+	value reflect.Value
+}
+
+func settings(c *Config) []setting {
+	var all []setting
+	collect(reflect.ValueOf(c).Elem(), "", &all)
+	return all
+}
+
+func collect(v reflect.Value, prefix string, all *[]setting) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+
+		if !field.IsExported() || name == "-" || name == "" {
+			continue
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			collect(v.Field(i), prefix+name+".", all)
+			continue
+		}
+
+		*all = append(*all, setting{path: prefix + name, field: field, value: v.Field(i)})
+	}
+}
+
+func (s setting) set(text string) error {
+	v := s.value
+
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(text)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.CanInt():
+		n, err := strconv.ParseInt(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.CanUint():
+		n, err := strconv.ParseUint(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func (s setting) String() string {
+	if s.field.Tag.Get("secret") == "true" {
+		if s.value.IsZero() {
+			return `""`
+		}
+		return redactedValue
+	}
+
+	switch value := s.value.Interface().(type) {
+	case string:
+		return strconv.Quote(value)
+	case []string:
+		return strconv.Quote(strings.Join(value, ","))
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// flagValue keeps the text of a flag until the flags are applied, after the
+// file and the environment.
+type flagValue struct {
+	setting setting
+	text    string
+	isSet   bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil || !f.setting.value.IsValid() || f.setting.value.IsZero() {
+		return ""
+	}
+	return f.setting.String()
+}
+
+func (f *flagValue) Set(text string) error {
+	f.text, f.isSet = text, true
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.setting.value.Kind() == reflect.Bool
+}
+
+// Load reads the configuration for the command-line arguments args,
+// without the program name, and validates it.
+func Load(args []string) (*Config, error) {
+	config := Default()
+	all := settings(config)
+
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	file := flags.String("config", "", "YAML configuration file (default $"+fileEnv+" or "+defaultFile+")")
+	flags.BoolVar(&config.printOnly, "print-config", false, "print the configuration, secrets redacted, and exit")
+
+	var flagValues []*flagValue
+	for _, s := range all {
+		if name := s.field.Tag.Get("flag"); name != "" {
+			value := &flagValue{setting: s}
+			flags.Var(value, name, s.field.Tag.Get("usage"))
+			flagValues = append(flagValues, value)
+		}
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if err := config.loadFile(*file); err != nil {
+		return nil, err
+	}
+
+	for _, s := range all {
+		name := s.field.Tag.Get("env")
+		if text := os.Getenv(name); name != "" && text != "" {
+			if err := s.set(text); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", errs.InvalidConfigError, name, err)
+			}
+		}
+	}
+
+	for _, value := range flagValues {
+		if value.isSet {
+			if err := value.setting.set(value.text); err != nil {
+				return nil, fmt.Errorf("%s: -%s: %w", errs.InvalidConfigError, value.setting.field.Tag.Get("flag"), err)
+			}
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	if path == "" {
+		path = os.Getenv(fileEnv)
+	}
+
+	explicit := path != ""
+	if !explicit {
+		path = defaultFile
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = c.decodeTOML(data)
+	} else {
+		err = c.decodeYAML(data)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", errs.InvalidConfigError, path, err)
+	}
+
+	c.File = path
+	return nil
+}
+
+func (c *Config) decodeYAML(data []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+// decodeTOML applies a TOML file, whose tables and keys are the sections
+// and keys of the YAML file.
+func (c *Config) decodeTOML(data []byte) error {
+	var document map[string]any
+
+	if _, err := toml.Decode(string(data), &document); err != nil {
+		return err
+	}
+
+	values := make(map[string]any)
+	flattenTOML(document, "", values)
+
+	for _, s := range settings(c) {
+		value, ok := values[s.path]
+		if !ok {
+			continue
+		}
+
+		delete(values, s.path)
+
+		if err := s.setTOML(value); err != nil {
+			return fmt.Errorf("%s: %w", s.path, err)
+		}
+	}
+
+	unknown := make([]string, 0, len(values))
+	for path := range values {
+		unknown = append(unknown, path)
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown keys %s", strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+func flattenTOML(table map[string]any, prefix string, values map[string]any) {
+	for key, value := range table {
+		if nested, ok := value.(map[string]any); ok {
+			flattenTOML(nested, prefix+key+".", values)
+			continue
+		}
+
+		values[prefix+key] = value
+	}
+}
+
+// setTOML sets the setting from a decoded TOML value. Durations are
+// strings, as in YAML.
+func (s setting) setTOML(value any) error {
+	switch value := value.(type) {
+	case string:
+		return s.set(value)
+	case bool:
+		return s.set(strconv.FormatBool(value))
+	case int64:
+		return s.set(strconv.FormatInt(value, 10))
+	case []any:
+		if s.value.Kind() != reflect.Slice {
+			return fmt.Errorf("an array is not a %s", s.value.Type())
+		}
+
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			text, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("array item %v is not a string", item)
+			}
+			items = append(items, text)
+		}
+
+		s.value.Set(reflect.ValueOf(items))
+		return nil
+	}
+
+	return fmt.Errorf("unsupported value %v", value)
+}
+
+// Redacted returns one "key = value" line per setting, secrets replaced.
+func (c *Config) Redacted() string {
+	var builder strings.Builder
+
+	for _, s := range settings(c) {
+		fmt.Fprintf(&builder, "%s = %s\n", s.path, s)
+	}
+
+	return builder.String()
+}
+
+// String and GoString keep secrets out of the logs whatever the verb used
+// to print a Config.
+func (c *Config) String() string {
+	return c.Redacted()
+}
+
+func (c *Config) GoString() string {
+	return c.Redacted()
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"server/accesslog"
+	"server/errs"
+	"server/logging"
+	"server/password"
+	"server/phone"
+	"server/tlsutil"
+)
+
+type problems []error
+
+func (p *problems) check(ok bool, path, format string, args ...any) {
+	if !ok {
+		*p = append(*p, fmt.Errorf("%s: "+format, append([]any{path}, args...)...))
+	}
+}
+
+// Validate returns every invalid setting at once.
+func (c *Config) Validate() error {
+	var p problems
+
+	_, port, err := net.SplitHostPort(c.Server.Addr)
+	p.check(err == nil && validPort(port, true), "server.addr", "must be host:port, got %q", c.Server.Addr)
+
+	p.check(c.Server.ReadTimeout > 0, "server.read_timeout", "must be positive")
+	p.check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout", "must be positive")
+	p.check(c.Server.WriteTimeout > 0, "server.write_timeout", "must be positive")
+	p.check(c.Server.IdleTimeout > 0, "server.idle_timeout", "must be positive")
+	p.check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive")
+	p.check(!c.Server.InsecureAdmin || c.Server.DevMode, "server.insecure_admin", "requires dev_mode")
+	// the embedded views never change, only views on disk can be reloaded
+	p.check(!c.Server.DevMode || c.Server.AssetsDir != "", "server.assets_dir", "must be set in dev mode to reload the views from disk")
+
+	_, err = accesslog.ParseTrustedProxies(c.Server.TrustedProxies)
+	p.check(err == nil, "server.trusted_proxies", "%v", err)
+
+	_, err = logging.ParseLevel(c.Log.Level)
+	p.check(err == nil, "log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	p.check(c.Log.Format == logging.FormatText || c.Log.Format == logging.FormatJSON,
+		"log.format", "must be %s or %s, got %q", logging.FormatText, logging.FormatJSON, c.Log.Format)
+
+	switch c.AccessLog.Format {
+	case accesslog.FormatCommon, accesslog.FormatCombined, accesslog.FormatJSON:
+	default:
+		p.check(false, "access_log.format", "must be %s, %s or %s, got %q",
+			accesslog.FormatCommon, accesslog.FormatCombined, accesslog.FormatJSON, c.AccessLog.Format)
+	}
+	p.check(c.AccessLog.MaxSize >= 0, "access_log.max_size", "must not be negative")
+	p.check(c.AccessLog.MaxBackups >= 0, "access_log.max_backups", "must not be negative")
+
+	if metrics := c.Metrics; metrics.Enabled {
+		if metrics.Addr != "" {
+			_, port, err := net.SplitHostPort(metrics.Addr)
+			p.check(err == nil && validPort(port, true), "metrics.addr", "must be host:port, got %q", metrics.Addr)
+			p.check(metrics.Addr != c.Server.Addr, "metrics.addr", "must differ from server.addr")
+		} else {
+			// the admin routes are closed to requests without a client certificate
+			p.check(c.TLS.AdminClientCAFile != "" || c.Server.InsecureAdmin,
+				"metrics.addr", "must be set unless tls.admin_client_ca_file protects /metrics on the main server")
+		}
+		p.check(metrics.Password == "" || metrics.Username != "", "metrics.username", "must be set with metrics.password")
+	}
+
+	if tlsConfig := c.TLS; tlsConfig.Enabled() || tlsConfig.KeyFile != "" {
+		p.check(tlsConfig.CertFile != "" && tlsConfig.KeyFile != "", "tls", "cert_file and key_file must be set together")
+		p.check(tlsConfig.ReloadInterval > 0, "tls.reload_interval", "must be positive")
+
+		_, err := tlsutil.ParseVersion(tlsConfig.MinVersion)
+		p.check(err == nil, "tls.min_version", "must be 1.0 to 1.3, got %q", tlsConfig.MinVersion)
+
+		_, err = tlsutil.ParseCipherSuites(tlsConfig.CipherSuites)
+		p.check(err == nil, "tls.cipher_suites", "%v", err)
+
+		if tlsConfig.RedirectAddr != "" {
+			_, port, err := net.SplitHostPort(tlsConfig.RedirectAddr)
+			p.check(err == nil && validPort(port, true), "tls.redirect_addr", "must be host:port, got %q", tlsConfig.RedirectAddr)
+		}
+
+		p.check(tlsConfig.HSTSMaxAge >= 0, "tls.hsts_max_age", "must not be negative")
+		// requirements of the browsers preload lists
+		p.check(!tlsConfig.HSTSPreload || tlsConfig.HSTSIncludeSubdomains && tlsConfig.HSTSMaxAge >= 365*24*time.Hour,
+			"tls.hsts_preload", "requires hsts_include_subdomains and an hsts_max_age of at least a year")
+	} else {
+		p.check(c.TLS.RedirectAddr == "", "tls.redirect_addr", "requires TLS")
+		p.check(c.TLS.AdminClientCAFile == "", "tls.admin_client_ca_file", "requires TLS")
+	}
+
+	p.check(c.Session.CookieName != "", "session.cookie_name", "must not be empty")
+	p.check(c.Session.CookieLifetime > 0, "session.cookie_lifetime", "must be positive")
+	p.check(c.Session.Expiration > 0, "session.expiration", "must be positive")
+	// browsers drop a secure cookie received over plain HTTP
+	p.check(!c.Session.Secure || c.TLS.Enabled() || len(c.Server.TrustedProxies) > 0,
+		"session.secure", "requires TLS, or trusted_proxies naming the proxy that terminates it")
+	p.check(c.Login.MaxAttempts >= 1, "login.max_attempts", "must be at least 1")
+
+	database := c.Database
+	p.check(database.Host != "", "database.host", "must not be empty")
+	p.check(validPort(database.Port, false), "database.port", "must be a port number, got %q", database.Port)
+	p.check(database.User != "", "database.user", "must not be empty")
+	p.check(database.Name != "", "database.name", "must not be empty")
+	p.check(database.QueryTimeout >= 0, "database.query_timeout", "must not be negative")
+	p.check(database.MaxOpenConns >= 0, "database.max_open_conns", "must not be negative, 0 is unlimited")
+	p.check(database.MaxIdleConns >= 0, "database.max_idle_conns", "must not be negative")
+	p.check(database.MaxOpenConns == 0 || database.MaxIdleConns <= database.MaxOpenConns,
+		"database.max_idle_conns", "must not exceed max_open_conns")
+	p.check(database.PingAttempts >= 1, "database.ping_attempts", "must be at least 1")
+	p.check(database.PingTimeout > 0, "database.ping_timeout", "must be positive")
+	p.check(len(database.Replicas) == 0 || database.ReplicaHealthInterval > 0,
+		"database.replica_health_interval", "must be positive when there are replicas")
+
+	for _, address := range database.Replicas {
+		_, port, err := net.SplitHostPort(address)
+		p.check(err == nil && validPort(port, false), "database.replicas", "must be host:port, got %q", address)
+	}
+
+	pass := c.Password
+	p.check(pass.MinLength >= 1, "password.min_length", "must be at least 1")
+	p.check(pass.MaxLength == 0 || pass.MaxLength >= pass.MinLength, "password.max_length", "must be 0 or at least min_length")
+	p.check(pass.MinScore >= 0 && pass.MinScore <= password.MaxScore, "password.min_score", "must be between 0 and %d", password.MaxScore)
+	p.check(pass.BreachedMinCount >= 1, "password.breached_min_count", "must be at least 1")
+	p.check(pass.HashAlgorithm == password.AlgorithmArgon2id || pass.HashAlgorithm == password.AlgorithmBcrypt,
+		"password.hash_algorithm", "must be %s or %s, got %q", password.AlgorithmArgon2id, password.AlgorithmBcrypt, pass.HashAlgorithm)
+	p.check(pass.HashAlgorithm != password.AlgorithmBcrypt || pass.MaxLength >= 1 && pass.MaxLength <= password.BcryptMaxBytes,
+		"password.max_length", "must be between min_length and %d with bcrypt, which ignores longer passwords", password.BcryptMaxBytes)
+	p.check(pass.BcryptCost >= 4 && pass.BcryptCost <= 31, "password.bcrypt_cost", "must be between 4 and 31")
+	p.check(pass.Argon2Memory >= 8*uint32(pass.Argon2Parallelism) && pass.Argon2Memory <= password.MaxArgon2Memory,
+		"password.argon2_memory", "must be at least 8 KiB per lane and at most %d KiB", password.MaxArgon2Memory)
+	p.check(pass.Argon2Iterations >= 1 && pass.Argon2Iterations <= password.MaxArgon2Iterations,
+		"password.argon2_iterations", "must be between 1 and %d", password.MaxArgon2Iterations)
+	p.check(pass.Argon2Parallelism >= 1 && pass.Argon2Parallelism <= password.MaxArgon2Parallelism,
+		"password.argon2_parallelism", "must be between 1 and %d", password.MaxArgon2Parallelism)
+
+	p.check(phone.IsSupportedRegion(c.Phone.DefaultRegion), "phone.default_region", "unsupported region %q", c.Phone.DefaultRegion)
+
+	switch c.SMS.Sender {
+	case "log":
+	case "webhook":
+		target, err := url.Parse(c.SMS.WebhookURL)
+		p.check(err == nil && (target.Scheme == "http" || target.Scheme == "https") && target.Host != "",
+			"sms.webhook_url", "must be an http(s) URL when sms.sender is webhook")
+	default:
+		p.check(false, "sms.sender", "must be log or webhook, got %q", c.SMS.Sender)
+	}
+
+	if len(p) > 0 {
+		return fmt.Errorf("%s:\n%w", errs.InvalidConfigError, errors.Join(p...))
+	}
+
+	return nil
+}
+
+func validPort(text string, allowZero bool) bool {
+	port, err := strconv.Atoi(text)
+	return err == nil && port <= 65535 && (port > 0 || allowZero && port == 0)
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+type PingConfig struct {
+	Attempts       int
+	Timeout        time.Duration
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+type ReplicaConfig struct {
+	Host string
+	Port string
+}
+
+type ReplicationConfig struct {
+	Replicas             []ReplicaConfig
+	HealthCheckInterval  time.Duration
+	ReadYourWritesWindow time.Duration
+}
+
+type Config struct {
+	Host               string
+	Port               string
+	User               string
+	Password           string
+	Database           string
+	QueryTimeout       time.Duration
+	SlowQueryThreshold time.Duration
+	Pool               PoolConfig
+	Ping               PingConfig
+	Replication        ReplicationConfig
+}
+
+func (c *Config) DataSourceName() string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", c.User, c.Password, c.Host, c.Port, c.Database)
+}
+
+func DefaultConfig() Config {
+	return Config{
+		QueryTimeout:       5 * time.Second,
+		SlowQueryThreshold: 200 * time.Millisecond,
+		Pool: PoolConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		Ping: PingConfig{
+			Attempts:       5,
+			Timeout:        2 * time.Second,
+			InitialBackoff: 500 * time.Millisecond,
+			MaxBackoff:     10 * time.Second,
+		},
+		Replication: ReplicationConfig{
+			HealthCheckInterval:  10 * time.Second,
+			ReadYourWritesWindow: 5 * time.Second,
+		},
+	}
+}
@@ -1,27 +1,37 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"server/errs"
 )
 
 type Connector interface {
-	Open(host, port, user, password, database string) error
+	Open(config Config) error
 	Close() error
-	GetConnection() (*sql.DB, error)
+	GetConnection() (*DB, error)
+	GetReadConnection(ctx context.Context) (*DB, error)
+	MarkWrite(key string)
+	Ping(ctx context.Context) error
+	Stats() (sql.DBStats, error)
+	WithQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc)
 }
 
 type connector struct {
-	connection *sql.DB
-	mu         sync.Mutex
+	connection   *DB
+	replicas     *replicaSet
+	queryTimeout time.Duration
+	mu           sync.Mutex
 }
 
-func (c *connector) Open(host, port, user, password, database string) error {
+func (c *connector) Open(config Config) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -29,13 +39,27 @@ func (c *connector) Open(host, port, user, password, database string) error {
 		return errors.New(errs.DatabaseConnectionAlreadyOpenError)
 	}
 
-	dataSourceName := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", user, password, host, port, database)
-	db, err := sql.Open("mysql", dataSourceName)
+	db, err := sql.Open("mysql", config.DataSourceName())
 	if err != nil {
 		return err
 	}
 
-	c.connection = db
+	configurePool(db, config.Pool)
+
+	if err = pingWithRetry(db, config.Ping); err != nil {
+		_ = db.Close()
+		return err
+	}
+
+	replicas, err := openReplicaSet(config)
+	if err != nil {
+		_ = db.Close()
+		return err
+	}
+
+	c.connection = newDB(db, "primary", config.SlowQueryThreshold)
+	c.replicas = replicas
+	c.queryTimeout = config.QueryTimeout
 	return nil
 }
 
@@ -47,12 +71,13 @@ func (c *connector) Close() error {
 		return errors.New(errs.DatabaseConnectionNotOpenError)
 	}
 
-	err := c.connection.Close()
+	err := errors.Join(c.connection.db.Close(), c.replicas.close())
 	c.connection = nil
+	c.replicas = nil
 	return err
 }
 
-func (c *connector) GetConnection() (*sql.DB, error) {
+func (c *connector) GetConnection() (*DB, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -63,4 +88,103 @@ func (c *connector) GetConnection() (*sql.DB, error) {
 	return c.connection, nil
 }
 
+func (c *connector) GetReadConnection(ctx context.Context) (*DB, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.connection == nil {
+		return nil, errors.New(errs.DatabaseConnectionNotEstablishedError)
+	}
+
+	routing := readRoutingFrom(ctx)
+	if routing.forcePrimary || c.replicas.recentlyWritten(routing.consistencyKey) {
+		return c.connection, nil
+	}
+
+	if replica := c.replicas.pick(); replica != nil {
+		return replica, nil
+	}
+
+	return c.connection, nil
+}
+
+func (c *connector) MarkWrite(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.replicas != nil {
+		c.replicas.markWrite(key)
+	}
+}
+
+func (c *connector) Ping(ctx context.Context) error {
+	connection, err := c.GetConnection()
+	if err != nil {
+		return err
+	}
+
+	return connection.db.PingContext(ctx)
+}
+
+func (c *connector) Stats() (sql.DBStats, error) {
+	connection, err := c.GetConnection()
+	if err != nil {
+		return sql.DBStats{}, err
+	}
+
+	return connection.db.Stats(), nil
+}
+
+func (c *connector) WithQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	c.mu.Lock()
+	timeout := c.queryTimeout
+	c.mu.Unlock()
+
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+func configurePool(db *sql.DB, pool PoolConfig) {
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+}
+
+func pingWithRetry(db *sql.DB, ping PingConfig) error {
+	var err error
+	backoff := ping.InitialBackoff
+
+	if ping.Attempts < 1 {
+		ping.Attempts = 1
+	}
+
+	for attempt := 1; attempt <= ping.Attempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), ping.Timeout)
+		err = db.PingContext(ctx)
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+
+		if attempt == ping.Attempts {
+			break
+		}
+
+		slog.Warn("database ping failed", "attempt", attempt, "attempts", ping.Attempts, "error", err, "retry_in", backoff)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > ping.MaxBackoff {
+			backoff = ping.MaxBackoff
+		}
+	}
+
+	return fmt.Errorf("%s: %w", errs.DatabaseUnreachableError, err)
+}
+
 var HandlerConnector Connector = &connector{}
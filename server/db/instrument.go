@@ -0,0 +1,311 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"server/metrics"
+)
+
+var (
+	queriesTotal = metrics.NewCounterVec(
+		"db_queries_total",
+		"Number of database queries executed, by target, operation and status.",
+		"target", "operation", "status",
+	)
+	queryDuration = metrics.NewHistogramVec(
+		"db_query_duration_seconds",
+		"Latency of database queries, by target and operation.",
+		metrics.DefaultDurationBuckets,
+		"target", "operation",
+	)
+	queryRows = metrics.NewCounterVec(
+		"db_query_rows_total",
+		"Number of rows read or affected by database queries, by target and operation.",
+		"target", "operation",
+	)
+
+	poolConnections = metrics.NewGaugeFunc(
+		"db_pool_connections",
+		"Connections of the primary database pool, by state.",
+		func() []metrics.Sample {
+			return poolSamples(func(stats sql.DBStats) []metrics.Sample {
+				return []metrics.Sample{
+					{LabelValues: []string{"open"}, Value: float64(stats.OpenConnections)},
+					{LabelValues: []string{"in_use"}, Value: float64(stats.InUse)},
+					{LabelValues: []string{"idle"}, Value: float64(stats.Idle)},
+				}
+			})
+		},
+		"state",
+	)
+	poolMaxOpenConnections = metrics.NewGaugeFunc(
+		"db_pool_max_open_connections",
+		"Maximum number of open connections of the primary database pool, 0 when unlimited.",
+		func() []metrics.Sample {
+			return poolSamples(func(stats sql.DBStats) []metrics.Sample {
+				return []metrics.Sample{{Value: float64(stats.MaxOpenConnections)}}
+			})
+		},
+	)
+	poolWaits = metrics.NewCounterFunc(
+		"db_pool_waits_total",
+		"Number of times a query waited for a free connection of the primary database pool.",
+		func() []metrics.Sample {
+			return poolSamples(func(stats sql.DBStats) []metrics.Sample {
+				return []metrics.Sample{{Value: float64(stats.WaitCount)}}
+			})
+		},
+	)
+	poolWaitDuration = metrics.NewCounterFunc(
+		"db_pool_wait_seconds_total",
+		"Total time spent waiting for a free connection of the primary database pool.",
+		func() []metrics.Sample {
+			return poolSamples(func(stats sql.DBStats) []metrics.Sample {
+				return []metrics.Sample{{Value: stats.WaitDuration.Seconds()}}
+			})
+		},
+	)
+	poolClosed = metrics.NewCounterFunc(
+		"db_pool_closed_total",
+		"Number of connections of the primary database pool closed, by reason.",
+		func() []metrics.Sample {
+			return poolSamples(func(stats sql.DBStats) []metrics.Sample {
+				return []metrics.Sample{
+					{LabelValues: []string{"max_idle"}, Value: float64(stats.MaxIdleClosed)},
+					{LabelValues: []string{"max_idle_time"}, Value: float64(stats.MaxIdleTimeClosed)},
+					{LabelValues: []string{"max_lifetime"}, Value: float64(stats.MaxLifetimeClosed)},
+				}
+			})
+		},
+		"reason",
+	)
+)
+
+// poolSamples reports no samples while the database is not open.
+func poolSamples(fn func(stats sql.DBStats) []metrics.Sample) []metrics.Sample {
+	stats, err := HandlerConnector.Stats()
+	if err != nil {
+		return nil
+	}
+	return fn(stats)
+}
+
+type instrumentation struct {
+	target             string
+	slowQueryThreshold time.Duration
+}
+
+func (i *instrumentation) observe(query string, args []any, start time.Time, rows int64, err error) {
+	elapsed := time.Since(start)
+	operation := queryOperation(query)
+
+	status := "ok"
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		status = "error"
+	}
+
+	queriesTotal.With(i.target, operation, status).Inc()
+	queryDuration.With(i.target, operation).Observe(elapsed.Seconds())
+	if rows > 0 {
+		queryRows.With(i.target, operation).Add(float64(rows))
+	}
+
+	if i.slowQueryThreshold > 0 && elapsed >= i.slowQueryThreshold {
+		slog.Warn("slow query", "target", i.target, "elapsed", elapsed, "rows", rows, "query", compactQuery(query), "args", redactArgs(args))
+	}
+}
+
+// queryOperation returns the leading SQL keyword, used as a low-cardinality label.
+func queryOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	return strings.ToLower(fields[0])
+}
+
+func compactQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// redactArgs describes query arguments by type only so that emails, hashes
+// and other user data never reach the logs.
+func redactArgs(args []any) string {
+	redacted := make([]string, len(args))
+
+	for i, arg := range args {
+		switch value := arg.(type) {
+		case nil:
+			redacted[i] = "NULL"
+		case string:
+			redacted[i] = fmt.Sprintf("string(len=%d)", len(value))
+		case []byte:
+			redacted[i] = fmt.Sprintf("bytes(len=%d)", len(value))
+		default:
+			redacted[i] = fmt.Sprintf("%T", value)
+		}
+	}
+
+	return "[" + strings.Join(redacted, ", ") + "]"
+}
+
+type DB struct {
+	db *sql.DB
+	instrumentation
+}
+
+func newDB(db *sql.DB, target string, slowQueryThreshold time.Duration) *DB {
+	return &DB{
+		db:              db,
+		instrumentation: instrumentation{target: target, slowQueryThreshold: slowQueryThreshold},
+	}
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	result, err := d.db.ExecContext(ctx, query, args...)
+	d.observe(query, args, start, rowsAffected(result, err), err)
+	return result, err
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...any) (*Rows, error) {
+	start := time.Now()
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		d.observe(query, args, start, 0, err)
+		return nil, err
+	}
+	return &Rows{Rows: rows, instrumentation: &d.instrumentation, query: query, args: args, start: start}, nil
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	start := time.Now()
+	row := d.db.QueryRowContext(ctx, query, args...)
+
+	return &Row{
+		row:             row,
+		instrumentation: &d.instrumentation,
+		query:           query,
+		args:            args,
+		start:           start,
+	}
+}
+
+func (d *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := d.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{tx: tx, instrumentation: &d.instrumentation}, nil
+}
+
+type Tx struct {
+	tx *sql.Tx
+	*instrumentation
+}
+
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	result, err := t.tx.ExecContext(ctx, query, args...)
+	t.observe(query, args, start, rowsAffected(result, err), err)
+	return result, err
+}
+
+func (t *Tx) QueryContext(ctx context.Context, query string, args ...any) (*Rows, error) {
+	start := time.Now()
+	rows, err := t.tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		t.observe(query, args, start, 0, err)
+		return nil, err
+	}
+	return &Rows{Rows: rows, instrumentation: t.instrumentation, query: query, args: args, start: start}, nil
+}
+
+func (t *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	start := time.Now()
+	row := t.tx.QueryRowContext(ctx, query, args...)
+
+	return &Row{
+		row:             row,
+		instrumentation: t.instrumentation,
+		query:           query,
+		args:            args,
+		start:           start,
+	}
+}
+
+func (t *Tx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *Tx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// Row records its measurement when Scan is called, since that is when
+// database/sql reports the query error and whether a row was found.
+type Row struct {
+	row *sql.Row
+	*instrumentation
+	query string
+	args  []any
+	start time.Time
+}
+
+func (r *Row) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+
+	var rows int64
+	if err == nil {
+		rows = 1
+	}
+	r.observe(r.query, r.args, r.start, rows, err)
+
+	return err
+}
+
+// Rows counts the rows iterated and records its measurement on Close.
+type Rows struct {
+	*sql.Rows
+	*instrumentation
+	query  string
+	args   []any
+	start  time.Time
+	count  int64
+	closed bool
+}
+
+func (r *Rows) Next() bool {
+	if r.Rows.Next() {
+		r.count++
+		return true
+	}
+	return false
+}
+
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	if !r.closed {
+		r.closed = true
+		r.observe(r.query, r.args, r.start, r.count, errors.Join(err, r.Rows.Err()))
+	}
+	return err
+}
+
+func rowsAffected(result sql.Result, err error) int64 {
+	if err != nil || result == nil {
+		return 0
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0
+	}
+	return affected
+}
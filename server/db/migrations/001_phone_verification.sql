@@ -0,0 +1,6 @@
+-- Phones are stored in E.164 form with the region they were entered for,
+-- and only verified phones can be used to recover an account.
+ALTER TABLE phones
+    ADD COLUMN is_verified TINYINT(1) NOT NULL DEFAULT 0;
+
+CREATE INDEX phones_phone_idx ON phones (phone);
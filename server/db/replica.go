@@ -0,0 +1,187 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type replica struct {
+	address    string
+	connection *DB
+	healthy    atomic.Bool
+}
+
+type replicaSet struct {
+	replicas       []*replica
+	next           atomic.Uint64
+	pingTimeout    time.Duration
+	stickyWindow   time.Duration
+	stickyWrites   map[string]time.Time
+	stickyMu       sync.Mutex
+	stopHealthLoop chan struct{}
+	healthLoopDone chan struct{}
+}
+
+func openReplicaSet(config Config) (*replicaSet, error) {
+	set := &replicaSet{
+		pingTimeout:  config.Ping.Timeout,
+		stickyWindow: config.Replication.ReadYourWritesWindow,
+		stickyWrites: make(map[string]time.Time),
+	}
+
+	for _, replicaConfig := range config.Replication.Replicas {
+		replicaDataSource := config
+		replicaDataSource.Host = replicaConfig.Host
+		replicaDataSource.Port = replicaConfig.Port
+
+		db, err := sql.Open("mysql", replicaDataSource.DataSourceName())
+		if err != nil {
+			set.close()
+			return nil, err
+		}
+
+		configurePool(db, config.Pool)
+
+		address := replicaConfig.Host + ":" + replicaConfig.Port
+
+		set.replicas = append(set.replicas, &replica{
+			address:    address,
+			connection: newDB(db, "replica "+address, config.SlowQueryThreshold),
+		})
+	}
+
+	set.checkHealth()
+
+	if len(set.replicas) > 0 && config.Replication.HealthCheckInterval > 0 {
+		set.stopHealthLoop = make(chan struct{})
+		set.healthLoopDone = make(chan struct{})
+		go set.healthLoop(config.Replication.HealthCheckInterval)
+	}
+
+	return set, nil
+}
+
+func (s *replicaSet) healthLoop(interval time.Duration) {
+	defer close(s.healthLoopDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.checkHealth()
+		case <-s.stopHealthLoop:
+			return
+		}
+	}
+}
+
+func (s *replicaSet) checkHealth() {
+	for _, r := range s.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), s.pingTimeout)
+		err := r.connection.db.PingContext(ctx)
+		cancel()
+
+		wasHealthy := r.healthy.Swap(err == nil)
+
+		if err != nil && wasHealthy {
+			slog.Warn("database replica marked unhealthy", "replica", r.address, "error", err)
+		} else if err == nil && !wasHealthy {
+			slog.Info("database replica marked healthy", "replica", r.address)
+		}
+	}
+}
+
+// pick returns the next healthy replica in round-robin order, or nil when
+// none is available and reads have to fall back to the primary.
+func (s *replicaSet) pick() *DB {
+	total := len(s.replicas)
+
+	for i := 0; i < total; i++ {
+		r := s.replicas[int(s.next.Add(1)%uint64(total))]
+		if r.healthy.Load() {
+			return r.connection
+		}
+	}
+
+	return nil
+}
+
+func (s *replicaSet) markWrite(key string) {
+	if s.stickyWindow <= 0 || key == "" {
+		return
+	}
+
+	s.stickyMu.Lock()
+	defer s.stickyMu.Unlock()
+
+	now := time.Now()
+	s.stickyWrites[key] = now.Add(s.stickyWindow)
+
+	for k, expiresAt := range s.stickyWrites {
+		if now.After(expiresAt) {
+			delete(s.stickyWrites, k)
+		}
+	}
+}
+
+func (s *replicaSet) recentlyWritten(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	s.stickyMu.Lock()
+	defer s.stickyMu.Unlock()
+
+	expiresAt, ok := s.stickyWrites[key]
+	return ok && time.Now().Before(expiresAt)
+}
+
+func (s *replicaSet) close() error {
+	if s.stopHealthLoop != nil {
+		close(s.stopHealthLoop)
+		<-s.healthLoopDone
+	}
+
+	var closeErrs []error
+	for _, r := range s.replicas {
+		if err := r.connection.db.Close(); err != nil {
+			closeErrs = append(closeErrs, err)
+		}
+	}
+
+	return errors.Join(closeErrs...)
+}
+
+type readRoutingKey struct{}
+
+type readRouting struct {
+	forcePrimary   bool
+	consistencyKey string
+}
+
+// ForcePrimary makes GetReadConnection return the primary for ctx.
+func ForcePrimary(ctx context.Context) context.Context {
+	routing, _ := ctx.Value(readRoutingKey{}).(readRouting)
+	routing.forcePrimary = true
+	return context.WithValue(ctx, readRoutingKey{}, routing)
+}
+
+// WithConsistencyKey tags ctx with the key of the data about to be read, so
+// reads of a key passed to MarkWrite stay on the primary while replicas catch up.
+func WithConsistencyKey(ctx context.Context, key string) context.Context {
+	routing, _ := ctx.Value(readRoutingKey{}).(readRouting)
+	routing.consistencyKey = key
+	return context.WithValue(ctx, readRoutingKey{}, routing)
+}
+
+func readRoutingFrom(ctx context.Context) readRouting {
+	routing, _ := ctx.Value(readRoutingKey{}).(readRouting)
+	return routing
+}
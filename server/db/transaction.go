@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type TxFunc func(tx *Tx) error
+
+// WithTransaction runs fn inside a transaction, committing when fn returns nil
+// and rolling back when it returns an error or panics.
+func WithTransaction(ctx context.Context, connection *DB, fn TxFunc) (err error) {
+	tx, err := connection.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = errors.Join(err, rollbackErr)
+			}
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	return fn(tx)
+}
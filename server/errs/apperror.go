@@ -0,0 +1,133 @@
+package errs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Code string
+
+const (
+	CodeInternal           Code = "internal"
+	CodeBadRequest         Code = "bad_request"
+	CodeValidation         Code = "validation"
+	CodeNotFound           Code = "not_found"
+	CodeInvalidCredentials Code = "invalid_credentials"
+	CodeTimeout            Code = "timeout"
+	CodeUnauthorized       Code = "unauthorized"
+	CodeForbidden          Code = "forbidden"
+	CodeMethodNotAllowed   Code = "method_not_allowed"
+	CodeGone               Code = "gone"
+	CodeTooManyRequests    Code = "too_many_requests"
+	CodeUnavailable        Code = "unavailable"
+)
+
+var statusCodes = map[int]Code{
+	http.StatusBadRequest:          CodeBadRequest,
+	http.StatusUnauthorized:        CodeUnauthorized,
+	http.StatusForbidden:           CodeForbidden,
+	http.StatusNotFound:            CodeNotFound,
+	http.StatusMethodNotAllowed:    CodeMethodNotAllowed,
+	http.StatusGone:                CodeGone,
+	http.StatusUnprocessableEntity: CodeValidation,
+	http.StatusTooManyRequests:     CodeTooManyRequests,
+	http.StatusInternalServerError: CodeInternal,
+	http.StatusServiceUnavailable:  CodeUnavailable,
+	http.StatusGatewayTimeout:      CodeTimeout,
+}
+
+// AppError describes a failure in terms the client can be shown: a stable
+// code, the HTTP status, the catalog key of a user-safe message and, for
+// validation failures, the form field at fault. The internal cause is only
+// ever logged.
+type AppError struct {
+	Code    Code
+	Status  int
+	Message string
+	Args    []any
+	Field   string
+	Cause   error
+}
+
+func (e *AppError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %v", e.Code, e.Cause)
+	}
+	return string(e.Code)
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Cause
+}
+
+func (e *AppError) WithField(field string) *AppError {
+	e.Field = field
+	return e
+}
+
+func (e *AppError) WithCause(cause error) *AppError {
+	e.Cause = cause
+	return e
+}
+
+func New(code Code, status int, message string, args ...any) *AppError {
+	return &AppError{Code: code, Status: status, Message: message, Args: args}
+}
+
+func Internal(cause error) *AppError {
+	return New(CodeInternal, http.StatusInternalServerError, InternalError).WithCause(cause)
+}
+
+func BadRequest(cause error) *AppError {
+	return New(CodeBadRequest, http.StatusBadRequest, BadRequestError).WithCause(cause)
+}
+
+func Validation(field, message string, args ...any) *AppError {
+	return New(CodeValidation, http.StatusUnprocessableEntity, message, args...).WithField(field)
+}
+
+func NotFound(message string, args ...any) *AppError {
+	return New(CodeNotFound, http.StatusNotFound, message, args...)
+}
+
+// Unavailable reports a dependency, such as the database, that cannot serve
+// the request right now.
+func Unavailable(cause error) *AppError {
+	return FromStatus(http.StatusServiceUnavailable).WithCause(cause)
+}
+
+// FromStatus returns an AppError for status with the generic message the
+// catalogs define for it.
+func FromStatus(status int) *AppError {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = CodeInternal
+	}
+
+	return New(code, status, fmt.Sprintf(StatusError, status))
+}
+
+// FromError converts err into an AppError, mapping the well known errors of
+// database/sql, bcrypt and context to their client-facing equivalent.
+func FromError(err error) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return NotFound(NotFoundError).WithCause(err)
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return New(CodeInvalidCredentials, http.StatusUnauthorized, InvalidCredentialsError).WithCause(err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return New(CodeTimeout, http.StatusGatewayTimeout, TimeoutError).WithCause(err)
+	default:
+		return Internal(err)
+	}
+}
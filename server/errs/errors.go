@@ -1,25 +1,51 @@
 package errs
 
 import (
-	"log"
 	"net/http"
-
-	"server/template"
 )
 
 const (
 	/*
-	 * error messages that will be displayed in the client view
+	 * keys of the error messages that will be displayed in the client view,
+	 * translated through the i18n catalogs
 	 */
-	IncorrectPasswordError = "Wrong password. Please try again or click on the 'Forgot your password?' link. Remember that you only have %d attempts."
-	NoUserFoundError       = "No user has been found registered with the email '%s'"
-	InvalidEmailError      = "The email '%s' is not a valid email."
-	EmptyPasswordError     = "The password cannot be empty."
-	InvalidUsernameError   = "The value '%s' is not valid data for the 'username' field."
-	ShortPasswordError     = "Password must contain %d letters or more (current letters: %d)."
-	DuplicateEmailError    = "The email '%s' is already registered. Please enter a different email address."
-	PasswordsNotMatchError = "Passwords do not match"
-	AccountBlockedError    = "Your account has been locked due to an excessive number of failed password attempts. To unlock your account, please click <a href='%s'>here</a> to recover your account. We are sorry for any inconvenience this may cause and we are here to help."
+	IncorrectPasswordError        = "error.incorrect_password"
+	NoUserFoundError              = "error.no_user_found"
+	InvalidEmailError             = "error.invalid_email"
+	EmptyPasswordError            = "error.empty_password"
+	InvalidUsernameError          = "error.invalid_username"
+	PasswordTooShortError         = "error.password.too_short"
+	PasswordTooLongError          = "error.password.too_long"
+	PasswordTooLongBytesError     = "error.password.too_long_bytes"
+	PasswordMissingLowerError     = "error.password.missing_lower"
+	PasswordMissingUpperError     = "error.password.missing_upper"
+	PasswordMissingDigitError     = "error.password.missing_digit"
+	PasswordMissingSymbolError    = "error.password.missing_symbol"
+	PasswordContainsEmailError    = "error.password.contains_email"
+	PasswordContainsUsernameError = "error.password.contains_username"
+	PasswordCommonError           = "error.password.common"
+	PasswordWeakError             = "error.password.weak"
+	PasswordBreachedError         = "error.password.breached"
+	PhoneInvalidError             = "error.phone.invalid"
+	PhoneLengthError              = "error.phone.length"
+	PhoneUnknownCountryError      = "error.phone.unknown_country"
+	PhoneInUseError               = "error.phone.in_use"
+	PhoneCodeInvalidError         = "error.phone.code_invalid"
+	PhoneCodeExpiredError         = "error.phone.code_expired"
+	PhoneCodeAttemptsError        = "error.phone.code_attempts"
+	PhoneResendWaitError          = "error.phone.resend_wait"
+	PhoneSendFailedError          = "error.phone.send_failed"
+	DuplicateEmailError           = "error.duplicate_email"
+	PasswordsNotMatchError        = "error.passwords_not_match"
+	AccountBlockedError           = "error.account_blocked"
+	NoAccountForRecoveryError     = "error.no_account_for_recovery"
+	InternalError                 = "error.internal"
+	BadRequestError               = "error.bad_request"
+	NotFoundError                 = "error.not_found"
+	InvalidCredentialsError       = "error.invalid_credentials"
+	TimeoutError                  = "error.timeout"
+	StatusError                   = "error.status.%d"
+	InternalServerErrorPageTitle  = "page.500.title"
 
 	/*
 	 * server status error messages
@@ -32,18 +58,21 @@ const (
 	DatabaseConnectionNotEstablishedError = "database connection has not been established"
 	DatabaseConnectionNotOpenError        = "database connection is not open"
 	DatabaseConnectionAlreadyOpenError    = "database connection is already open"
+	DatabaseUnreachableError              = "database could not be reached"
+	BreachedIndexInvalidError             = "not a breached password index"
+	BreachedSourceNotSortedError          = "breached password source is not sorted by hash"
+	BreachedSourceInvalidLineError        = "invalid breached password entry"
+	InvalidPasswordHashError              = "invalid or unsupported password hash"
+	UnknownHashAlgorithmError             = "unknown password hash algorithm"
+	SMSDeliveryFailedError                = "sms gateway rejected the message"
+	InvalidConfigError                    = "invalid configuration"
+	UnknownTLSVersionError                = "unknown TLS version"
+	UnknownCipherSuiteError               = "unknown or insecure cipher suite"
+	NoCertificatesFoundError              = "no certificates found"
+	InvalidProxyAddressError              = "invalid proxy address"
+	UnknownAccessLogFormatError           = "unknown access log format"
 )
 
-func InternalServerErrorHandler(w http.ResponseWriter, err error, BackRoute string) {
-	w.WriteHeader(http.StatusInternalServerError)
-	log.Println(err)
-
-	_, err = template.Render(w, &template.InternalServerErrorPageData{
-		Title:     "500 Internal Server Error",
-		BackRoute: BackRoute,
-	}, template.GetView("500"))
-
-	if err != nil {
-		http.Error(w, InternalServerError, http.StatusInternalServerError)
-	}
+func InternalServerErrorHandler(w http.ResponseWriter, r *http.Request, err error, BackRoute string) {
+	Render(w, r, Internal(err), BackRoute)
 }
@@ -0,0 +1,151 @@
+package errs
+
+import (
+	"encoding/json"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"server/i18n"
+	"server/logging"
+	"server/requestid"
+	"server/template"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypeBaseURI = "/problems/"
+)
+
+// problem is an RFC 7807 problem details document, extended with the
+// machine-readable error code, the offending field and the request ID.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      Code   `json:"code"`
+	Field     string `json:"field,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// errorPages holds the statuses with a page of their own. The others use the
+// generic "error" page, headed by the "page.errors.<status>.heading" message
+// when there is one.
+var errorPages = map[int]string{
+	http.StatusInternalServerError: "500",
+	http.StatusServiceUnavailable:  "error",
+}
+
+func errorPage(status int) string {
+	if page, ok := errorPages[status]; ok {
+		return page
+	}
+	if status >= http.StatusInternalServerError {
+		return errorPages[http.StatusInternalServerError]
+	}
+	return "error"
+}
+
+// WantsJSON reports whether the client prefers a JSON response, either by
+// asking for it in Accept or by sending a JSON body.
+func WantsJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			return true
+		}
+		if mediaType == "text/html" {
+			return false
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// Render is the single place where errors reach the client. Server errors
+// are logged with their cause, and the response is problem+json or an HTML
+// page depending on what the request asked for. backRoute is the link
+// offered on the HTML page.
+func Render(w http.ResponseWriter, r *http.Request, err error, backRoute string) {
+	appErr := FromError(err)
+	requestID := requestid.FromContext(r.Context())
+
+	if appErr.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "request failed", "status", appErr.Status, logging.Err(appErr))
+	}
+
+	locale := i18n.FromContext(r.Context())
+	message := i18n.T(locale, appErr.Message, appErr.Args...)
+
+	if WantsJSON(r) {
+		renderProblem(w, r, appErr, message, requestID)
+		return
+	}
+
+	renderHTML(w, r, appErr, message, backRoute, requestID)
+}
+
+// RenderStatus renders the generic error for status.
+func RenderStatus(w http.ResponseWriter, r *http.Request, status int, backRoute string) {
+	Render(w, r, FromStatus(status), backRoute)
+}
+
+func renderProblem(w http.ResponseWriter, r *http.Request, appErr *AppError, message, requestID string) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(appErr.Status)
+
+	_ = json.NewEncoder(w).Encode(problem{
+		Type:      problemTypeBaseURI + string(appErr.Code),
+		Title:     http.StatusText(appErr.Status),
+		Status:    appErr.Status,
+		Detail:    message,
+		Instance:  r.URL.Path,
+		Code:      appErr.Code,
+		Field:     appErr.Field,
+		RequestID: requestID,
+	})
+}
+
+func renderHTML(w http.ResponseWriter, r *http.Request, appErr *AppError, message, backRoute, requestID string) {
+	var data interface{}
+
+	if appErr.Status >= http.StatusInternalServerError && appErr.Status != http.StatusServiceUnavailable {
+		data = &template.InternalServerErrorPageData{
+			Title:     InternalServerErrorPageTitle,
+			BackRoute: backRoute,
+			RequestID: requestID,
+		}
+	} else {
+		data = &template.ErrorPageData{
+			Title:     errorTitle(i18n.FromContext(r.Context()), appErr.Status),
+			Status:    appErr.Status,
+			Message:   message,
+			BackRoute: backRoute,
+			RequestID: requestID,
+		}
+	}
+
+	if _, err := template.RenderStatus(w, r, appErr.Status, data, template.GetPage(errorPage(appErr.Status))); err != nil {
+		slog.ErrorContext(r.Context(), "rendering the error page failed", logging.Err(err))
+		http.Error(w, http.StatusText(appErr.Status), appErr.Status)
+	}
+}
+
+// errorTitle returns the message key of the heading of status, or its
+// status text when it has none.
+func errorTitle(locale string, status int) string {
+	key := "page.errors." + strconv.Itoa(status) + ".heading"
+	if i18n.T(locale, key) == key {
+		return http.StatusText(status)
+	}
+	return key
+}
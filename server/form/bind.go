@@ -0,0 +1,169 @@
+package form
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	formTagName         = "form"
+	maxMultipartMemory  = 10 << 20
+	maxJSONBodyBytes    = 1 << 20
+	jsonContentType     = "application/json"
+	multipartFormPrefix = "multipart/"
+)
+
+var ErrUnsupportedTarget = errors.New("form: bind target must be a pointer to a struct")
+
+// Bind fills the fields of dst tagged with `form:"name"` from the request
+// body, which may be urlencoded, multipart or JSON. Query parameters are
+// used as well for urlencoded and multipart requests.
+func Bind(r *http.Request, dst any) error {
+	target := reflect.ValueOf(dst)
+	if target.Kind() != reflect.Pointer || target.Elem().Kind() != reflect.Struct {
+		return ErrUnsupportedTarget
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch {
+	case mediaType == jsonContentType:
+		return bindJSON(r, target.Elem())
+	case strings.HasPrefix(mediaType, multipartFormPrefix):
+		if err := r.ParseMultipartForm(maxMultipartMemory); err != nil {
+			return err
+		}
+	default:
+		if err := r.ParseForm(); err != nil {
+			return err
+		}
+	}
+
+	return bindValues(r.Form, target.Elem())
+}
+
+func bindValues(values map[string][]string, target reflect.Value) error {
+	return eachFormField(target, func(name string, field reflect.Value) error {
+		fieldValues, ok := values[name]
+		if !ok {
+			return nil
+		}
+		return setField(field, fieldValues)
+	})
+}
+
+func bindJSON(r *http.Request, target reflect.Value) error {
+	var body map[string]json.RawMessage
+
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxJSONBodyBytes))
+	if err := decoder.Decode(&body); err != nil {
+		return err
+	}
+
+	return eachFormField(target, func(name string, field reflect.Value) error {
+		raw, ok := body[name]
+		if !ok {
+			return nil
+		}
+
+		if err := json.Unmarshal(raw, field.Addr().Interface()); err != nil {
+			return fmt.Errorf("form: field %q: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// eachFormField calls fn for every settable field of target with a form tag,
+// descending into embedded structs.
+func eachFormField(target reflect.Value, fn func(name string, field reflect.Value) error) error {
+	targetType := target.Type()
+
+	for i := 0; i < targetType.NumField(); i++ {
+		structField := targetType.Field(i)
+		field := target.Field(i)
+
+		if structField.Anonymous && field.Kind() == reflect.Struct {
+			if err := eachFormField(field, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := formFieldName(structField)
+		if name == "" || !field.CanSet() {
+			continue
+		}
+
+		if err := fn(name, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func formFieldName(structField reflect.StructField) string {
+	name, _, _ := strings.Cut(structField.Tag.Get(formTagName), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+func setField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String {
+		field.Set(reflect.ValueOf(append([]string(nil), values...)).Convert(field.Type()))
+		return nil
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+	value := values[0]
+
+	if value == "" && field.Kind() != reflect.String {
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil && value == "on" {
+			parsed, err = true, nil
+		}
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(parsed)
+	default:
+		return fmt.Errorf("form: unsupported field type %s", field.Type())
+	}
+
+	return nil
+}
@@ -10,6 +10,8 @@ type User struct {
 	PhoneId       int
 }
 
+// UserWithPhone holds the phone in E.164 form and CountryCode the region
+// it was entered for, such as "MX".
 type UserWithPhone struct {
 	User
 	Phone       string
@@ -17,37 +19,53 @@ type UserWithPhone struct {
 }
 
 type LoginFormFields struct {
-	Email    string
-	Password string
+	Email    string `form:"email" validate:"email" messages:"email:error.invalid_email"`
+	Password string `form:"password" validate:"required" messages:"required:error.empty_password"`
 }
 
 type SignupFormFields struct {
-	Username        string
-	Email           string
-	Password        string
-	ConfirmPassword string
+	Username        string `form:"username" validate:"required" messages:"required:error.username_required"`
+	Email           string `form:"email" validate:"email" messages:"email:error.invalid_email"`
+	Password        string `form:"password" validate:"password"`
+	ConfirmPassword string `form:"confirm_password" validate:"eqfield=Password" messages:"eqfield:error.passwords_not_match"`
+}
+
+type PhoneFormFields struct {
+	Country string `form:"country" validate:"required"`
+	Phone   string `form:"phone" validate:"required,phone=Country"`
+}
+
+type PhoneVerificationFormFields struct {
+	Code string `form:"code" validate:"required"`
 }
 
 type RecoveryMethodType string
 
+const (
+	RecoveryMethodEmail RecoveryMethodType = "email"
+	RecoveryMethodPhone RecoveryMethodType = "phone"
+)
+
 func (r *RecoveryMethodType) SetAsEmail() {
-	*r = "email"
+	*r = RecoveryMethodEmail
 }
 
 func (r *RecoveryMethodType) SetAsPhone() {
-	*r = "phone"
+	*r = RecoveryMethodPhone
 }
 
 type RecoveryFromFields struct {
-	Value      string
+	Value      string `form:"recovery_method" validate:"required"`
 	MethodType RecoveryMethodType
 }
 
 const (
-	MinNumberCharsPassword   = 5
-	UsernameFieldName        = "username"
-	EmailFieldName           = "email"
-	PasswordFieldName        = "password"
-	ConfirmPasswordFieldName = "confirm_password"
-	RecoveryMethodFieldName  = "recovery_method"
+	UsernameFieldName         = "username"
+	EmailFieldName            = "email"
+	PasswordFieldName         = "password"
+	ConfirmPasswordFieldName  = "confirm_password"
+	RecoveryMethodFieldName   = "recovery_method"
+	CountryFieldName          = "country"
+	PhoneFieldName            = "phone"
+	VerificationCodeFieldName = "code"
 )
@@ -0,0 +1,290 @@
+package form
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"server/i18n"
+	"server/utils"
+)
+
+const (
+	validateTagName = "validate"
+	messagesTagName = "messages"
+)
+
+// FieldError is a failed rule on a form field. Message is the catalog key of
+// the text shown to the user and Args the values it is formatted with.
+type FieldError struct {
+	Field   string
+	Rule    string
+	Message string
+	Args    []any
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("form: field %q failed rule %q", e.Field, e.Rule)
+}
+
+// Translate formats the message in locale, picking its plural form from the
+// first argument when it is a count.
+func (e *FieldError) Translate(locale string) string {
+	if len(e.Args) > 0 {
+		if count, ok := e.Args[0].(int); ok {
+			return i18n.TN(locale, e.Message, count, e.Args...)
+		}
+	}
+	return i18n.T(locale, e.Message, e.Args...)
+}
+
+// ValidationErrors holds the first failed rule of every invalid field, in
+// the order the fields are declared.
+type ValidationErrors []*FieldError
+
+func (v ValidationErrors) Error() string {
+	fields := make([]string, len(v))
+	for i, fieldErr := range v {
+		fields[i] = fieldErr.Field
+	}
+	return "form: invalid fields: " + strings.Join(fields, ", ")
+}
+
+func (v ValidationErrors) Get(field string) *FieldError {
+	for _, fieldErr := range v {
+		if fieldErr.Field == field {
+			return fieldErr
+		}
+	}
+	return nil
+}
+
+// Translate returns the message of every error keyed by field name.
+func (v ValidationErrors) Translate(locale string) map[string]string {
+	messages := make(map[string]string, len(v))
+	for _, fieldErr := range v {
+		messages[fieldErr.Field] = fieldErr.Translate(locale)
+	}
+	return messages
+}
+
+// RuleContext is what a rule gets to look at: the field value, the rule
+// parameter written after "=" in the tag, and the whole struct so rules can
+// compare fields with each other.
+type RuleContext struct {
+	Field  reflect.Value
+	Param  string
+	Struct reflect.Value
+}
+
+func (rc RuleContext) String() string {
+	if rc.Field.Kind() == reflect.String {
+		return rc.Field.String()
+	}
+	return fmt.Sprint(rc.Field.Interface())
+}
+
+// Failure describes why a rule rejected a field. Message may be left empty
+// to use the key from the messages tag or the rule's default one.
+type Failure struct {
+	Message string
+	Args    []any
+}
+
+func Fail(args ...any) *Failure {
+	return &Failure{Args: args}
+}
+
+// Rule returns nil when the field is valid.
+type Rule func(rc RuleContext) *Failure
+
+var (
+	rules = map[string]Rule{
+		"required": requiredRule,
+		"email":    emailRule,
+		"min":      minRule,
+		"max":      maxRule,
+		"eqfield":  eqFieldRule,
+	}
+	rulesMu sync.RWMutex
+)
+
+// RegisterRule makes rule usable in validate tags under name. Its default
+// message key is "error.field.<name>".
+func RegisterRule(name string, rule Rule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rules[name] = rule
+}
+
+func lookupRule(name string) (Rule, bool) {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	rule, ok := rules[name]
+	return rule, ok
+}
+
+func requiredRule(rc RuleContext) *Failure {
+	if rc.Field.Kind() == reflect.String && strings.TrimSpace(rc.Field.String()) != "" {
+		return nil
+	}
+	if rc.Field.Kind() != reflect.String && !rc.Field.IsZero() {
+		return nil
+	}
+	return Fail()
+}
+
+func emailRule(rc RuleContext) *Failure {
+	value := rc.String()
+	if utils.IsValidEmail(value) {
+		return nil
+	}
+	return Fail(value)
+}
+
+// size is the length in characters of strings, the number of elements of
+// slices and maps, and the value itself for numbers.
+func size(field reflect.Value) float64 {
+	switch field.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(field.String()))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(field.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(field.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(field.Uint())
+	case reflect.Float32, reflect.Float64:
+		return field.Float()
+	}
+	return 0
+}
+
+func sizeBound(rc RuleContext) (float64, int) {
+	bound, err := strconv.ParseFloat(rc.Param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("form: invalid rule parameter %q", rc.Param))
+	}
+	return bound, int(size(rc.Field))
+}
+
+func minRule(rc RuleContext) *Failure {
+	bound, current := sizeBound(rc)
+	if size(rc.Field) >= bound {
+		return nil
+	}
+	return Fail(int(bound), current)
+}
+
+func maxRule(rc RuleContext) *Failure {
+	bound, current := sizeBound(rc)
+	if size(rc.Field) <= bound {
+		return nil
+	}
+	return Fail(int(bound), current)
+}
+
+func eqFieldRule(rc RuleContext) *Failure {
+	other := rc.Struct.FieldByName(rc.Param)
+	if !other.IsValid() {
+		panic(fmt.Sprintf("form: eqfield refers to unknown field %q", rc.Param))
+	}
+	if reflect.DeepEqual(rc.Field.Interface(), other.Interface()) {
+		return nil
+	}
+	return Fail()
+}
+
+// parseMessages reads a `messages:"rule:key,rule:key"` tag.
+func parseMessages(tag string) map[string]string {
+	messages := make(map[string]string)
+
+	for _, entry := range strings.Split(tag, ",") {
+		rule, key, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if ok {
+			messages[rule] = key
+		}
+	}
+	return messages
+}
+
+// Validate checks the rules declared in the validate tags of src, a struct
+// or a pointer to one, and returns ValidationErrors when any field fails.
+// Rules run in the order they are written and stop at the first failure of
+// each field. Messages default to "error.field.<rule>" and can be changed
+// per rule with a messages tag.
+func Validate(src any) error {
+	target := reflect.Indirect(reflect.ValueOf(src))
+	if target.Kind() != reflect.Struct {
+		return ErrUnsupportedTarget
+	}
+
+	var validationErrors ValidationErrors
+	validateStruct(target, target, &validationErrors)
+
+	if len(validationErrors) > 0 {
+		return validationErrors
+	}
+	return nil
+}
+
+func validateStruct(root, target reflect.Value, validationErrors *ValidationErrors) {
+	targetType := target.Type()
+
+	for i := 0; i < targetType.NumField(); i++ {
+		structField := targetType.Field(i)
+		field := target.Field(i)
+
+		if structField.Anonymous && field.Kind() == reflect.Struct {
+			validateStruct(root, field, validationErrors)
+			continue
+		}
+
+		tag := structField.Tag.Get(validateTagName)
+		if tag == "" {
+			continue
+		}
+
+		name := formFieldName(structField)
+		if name == "" {
+			name = structField.Name
+		}
+
+		if fieldErr := validateField(name, tag, structField.Tag.Get(messagesTagName), field, root); fieldErr != nil {
+			*validationErrors = append(*validationErrors, fieldErr)
+		}
+	}
+}
+
+func validateField(name, tag, messagesTag string, field, root reflect.Value) *FieldError {
+	messages := parseMessages(messagesTag)
+
+	for _, ruleSpec := range strings.Split(tag, ",") {
+		ruleName, param, _ := strings.Cut(strings.TrimSpace(ruleSpec), "=")
+
+		rule, ok := lookupRule(ruleName)
+		if !ok {
+			panic(fmt.Sprintf("form: unknown validation rule %q", ruleName))
+		}
+
+		failure := rule(RuleContext{Field: field, Param: param, Struct: root})
+		if failure == nil {
+			continue
+		}
+
+		message := failure.Message
+		if message == "" {
+			message = messages[ruleName]
+		}
+		if message == "" {
+			message = "error.field." + ruleName
+		}
+
+		return &FieldError{Field: name, Rule: ruleName, Message: message, Args: failure.Args}
+	}
+
+	return nil
+}
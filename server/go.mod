@@ -1,12 +1,17 @@
 module server
 
-go 1.20
+go 1.21
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/go-session/session v3.1.2+incompatible
 	github.com/go-sql-driver/mysql v1.7.1
 	github.com/joho/godotenv v1.5.1
 	golang.org/x/crypto v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require github.com/smartystreets/goconvey v1.8.1 // indirect
+require (
+	github.com/smartystreets/goconvey v1.8.1 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+)
@@ -0,0 +1,237 @@
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLocale    = "en"
+	LocaleCookieName = "lang"
+	localeCookieAge  = 365 * 24 * time.Hour
+)
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// Message holds the plural forms of a translation. Catalog entries written as
+// a plain JSON string only fill Other, which is used for every count.
+type Message struct {
+	One   string `json:"one"`
+	Other string `json:"other"`
+}
+
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		m.Other = text
+		return nil
+	}
+
+	type plainMessage Message
+	return json.Unmarshal(data, (*plainMessage)(m))
+}
+
+type catalog map[string]Message
+
+var catalogs = map[string]catalog{}
+
+// Load reads the message catalog of every locale in the locales directory.
+func Load() error {
+	files, err := fs.Glob(localeFiles, "locales/*.json")
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]catalog, len(files))
+
+	for _, file := range files {
+		content, err := localeFiles.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		var messages catalog
+		if err = json.Unmarshal(content, &messages); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		loaded[strings.TrimSuffix(path.Base(file), ".json")] = messages
+	}
+
+	if _, ok := loaded[DefaultLocale]; !ok {
+		return fmt.Errorf("missing catalog for default locale %q", DefaultLocale)
+	}
+
+	catalogs = loaded
+	return nil
+}
+
+func IsSupported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+func Supported() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+func lookup(locale, key string) (Message, bool) {
+	if message, ok := catalogs[locale][key]; ok {
+		return message, true
+	}
+
+	message, ok := catalogs[DefaultLocale][key]
+	return message, ok
+}
+
+// T translates key into locale, formatting args into the message the same
+// way fmt.Sprintf does. Unknown keys are returned unchanged.
+func T(locale, key string, args ...any) string {
+	message, ok := lookup(locale, key)
+	if !ok {
+		return key
+	}
+
+	return format(message.Other, args)
+}
+
+// TN translates key choosing the plural form that matches count in locale.
+func TN(locale, key string, count int, args ...any) string {
+	message, ok := lookup(locale, key)
+	if !ok {
+		return key
+	}
+
+	text := message.Other
+	if pluralForm(locale, count) == "one" && message.One != "" {
+		text = message.One
+	}
+
+	return format(text, args)
+}
+
+func format(text string, args []any) string {
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// pluralForm implements the CLDR cardinal rules of the supported locales.
+func pluralForm(locale string, count int) string {
+	switch locale {
+	case "en", "es":
+		if count == 1 {
+			return "one"
+		}
+	}
+	return "other"
+}
+
+type localeKey struct{}
+
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+func FromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(localeKey{}).(string); ok {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// Negotiate picks the locale of a request: the preference stored in the
+// locale cookie first, then the best supported match in Accept-Language.
+func Negotiate(r *http.Request) string {
+	if cookie, err := r.Cookie(LocaleCookieName); err == nil && IsSupported(cookie.Value) {
+		return cookie.Value
+	}
+
+	for _, tag := range parseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		if IsSupported(tag) {
+			return tag
+		}
+
+		base, _, _ := strings.Cut(tag, "-")
+		if IsSupported(base) {
+			return base
+		}
+	}
+
+	return DefaultLocale
+}
+
+// parseAcceptLanguage returns the language tags of an Accept-Language
+// header lower-cased and ordered by decreasing quality.
+func parseAcceptLanguage(header string) []string {
+	type weightedTag struct {
+		tag     string
+		quality float64
+	}
+
+	var tags []weightedTag
+
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = q
+			}
+		}
+
+		if quality > 0 {
+			tags = append(tags, weightedTag{tag: strings.ToLower(tag), quality: quality})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].quality > tags[j].quality
+	})
+
+	result := make([]string, len(tags))
+	for i, tag := range tags {
+		result[i] = tag.tag
+	}
+	return result
+}
+
+func SetLocaleCookie(w http.ResponseWriter, locale string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     LocaleCookieName,
+		Value:    locale,
+		Path:     "/",
+		MaxAge:   int(localeCookieAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := Negotiate(r)
+		w.Header().Add("Vary", "Accept-Language")
+		w.Header().Set("Content-Language", locale)
+		next.ServeHTTP(w, r.WithContext(WithLocale(r.Context(), locale)))
+	})
+}
@@ -0,0 +1,88 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Hook releases the resources of a component. It must return once ctx is
+// done, even if its work is not finished.
+type Hook func(ctx context.Context) error
+
+type namedHook struct {
+	name string
+	hook Hook
+}
+
+// Manager runs the shutdown hooks of the components in the reverse order of
+// their registration, like deferred calls: a component registered after the
+// ones it uses is stopped before them.
+type Manager struct {
+	mu       sync.Mutex
+	hooks    []namedHook
+	stopping atomic.Bool
+	once     sync.Once
+	err      error
+}
+
+func (m *Manager) OnShutdown(name string, hook Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hooks = append(m.hooks, namedHook{name: name, hook: hook})
+}
+
+// Stopping reports whether Shutdown has started.
+func (m *Manager) Stopping() bool {
+	return m.stopping.Load()
+}
+
+// Shutdown runs every hook once, even when a previous one failed, sharing
+// the deadline of ctx. Later calls return the result of the first one.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.once.Do(func() {
+		m.stopping.Store(true)
+
+		m.mu.Lock()
+		hooks := append([]namedHook(nil), m.hooks...)
+		m.mu.Unlock()
+
+		var hookErrs []error
+
+		for i := len(hooks) - 1; i >= 0; i-- {
+			start := time.Now()
+
+			if err := hooks[i].hook(ctx); err != nil {
+				slog.Error("shutdown hook failed", "hook", hooks[i].name, "elapsed", time.Since(start), "error", err)
+				hookErrs = append(hookErrs, fmt.Errorf("%s: %w", hooks[i].name, err))
+				continue
+			}
+
+			slog.Info("shutdown hook done", "hook", hooks[i].name, "elapsed", time.Since(start))
+		}
+
+		m.err = errors.Join(hookErrs...)
+	})
+
+	return m.err
+}
+
+// Default is the manager of the application.
+var Default = &Manager{}
+
+func OnShutdown(name string, hook Hook) {
+	Default.OnShutdown(name, hook)
+}
+
+func Stopping() bool {
+	return Default.Stopping()
+}
+
+func Shutdown(ctx context.Context) error {
+	return Default.Shutdown(ctx)
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"server/requestid"
+)
+
+// requestFields holds what becomes known about the request while it is
+// served. The middleware stores it in the context before the handlers run,
+// so what they set is seen by the logs written after they return.
+type requestFields struct {
+	mu     sync.Mutex
+	userID int
+}
+
+type contextKey struct{}
+
+func WithRequestFields(ctx context.Context) context.Context {
+	if fieldsFromContext(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, &requestFields{})
+}
+
+func fieldsFromContext(ctx context.Context) *requestFields {
+	fields, _ := ctx.Value(contextKey{}).(*requestFields)
+	return fields
+}
+
+// SetUserID attaches the authenticated user to the logs of the request.
+func SetUserID(ctx context.Context, userID int) {
+	if fields := fieldsFromContext(ctx); fields != nil {
+		fields.mu.Lock()
+		fields.userID = userID
+		fields.mu.Unlock()
+	}
+}
+
+// UserID returns the user set by SetUserID, 0 when there is none.
+func UserID(ctx context.Context) int {
+	fields := fieldsFromContext(ctx)
+	if fields == nil {
+		return 0
+	}
+
+	fields.mu.Lock()
+	defer fields.mu.Unlock()
+	return fields.userID
+}
+
+// Middleware makes the request ready for SetUserID. It must run inside
+// requestid.Middleware for the records to carry the request ID.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithRequestFields(r.Context())))
+	})
+}
+
+// contextHandler adds request_id and user_id to the records logged with a
+// request context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if id := requestid.FromContext(ctx); id != "" {
+			record.AddAttrs(slog.String("request_id", id))
+		}
+		if userID := UserID(ctx); userID != 0 {
+			record.AddAttrs(slog.Int("user_id", userID))
+		}
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,70 @@
+// Package logging configures log/slog as the logger of the server. Records
+// carry the request and user IDs found in their context, and the values of
+// sensitive attributes and struct fields are redacted before being written.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+type Options struct {
+	Format    string
+	Level     slog.Level
+	AddSource bool
+}
+
+// ParseLevel accepts debug, info, warn and error, with an optional offset
+// such as warn+2.
+func ParseLevel(text string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(text))
+	return level, err
+}
+
+// New returns a logger writing to w in the format of opts.
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	handlerOptions := &slog.HandlerOptions{
+		AddSource:   opts.AddSource,
+		Level:       opts.Level,
+		ReplaceAttr: redactAttr,
+	}
+
+	var handler slog.Handler
+
+	switch strings.ToLower(opts.Format) {
+	case FormatText, "":
+		handler = slog.NewTextHandler(w, handlerOptions)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, handlerOptions)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+
+	return slog.New(&contextHandler{Handler: handler}), nil
+}
+
+// Setup makes the logger of opts the default one, which the log package
+// also writes through, so the remaining log.Printf calls are formatted and
+// filtered like the rest.
+func Setup(w io.Writer, opts Options) error {
+	logger, err := New(w, opts)
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(logger)
+	return nil
+}
+
+// Err is the conventional attribute of the error of a record.
+func Err(err error) slog.Attr {
+	return slog.Any("error", err)
+}
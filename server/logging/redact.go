@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+)
+
+const redactedValue = "******"
+
+// sensitiveNames are matched against attribute keys and struct field names,
+// lowercased and without separators, so "Password", "reset_token" and
+// "X-Api-Key" are all caught.
+var sensitiveNames = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"apikey",
+	"authorization",
+	"cookie",
+	"codehash",
+}
+
+func isSensitive(name string) bool {
+	name = strings.ToLower(name)
+	name = strings.NewReplacer("_", "", "-", "", ".", "").Replace(name)
+
+	for _, sensitive := range sensitiveNames {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactAttr is the ReplaceAttr of the handlers. Structs are turned into
+// groups so that their fields are checked one by one; the handler calls
+// redactAttr again on each of them.
+func redactAttr(_ []string, attr slog.Attr) slog.Attr {
+	if isSensitive(attr.Key) {
+		return slog.String(attr.Key, redactedValue)
+	}
+
+	if attr.Value.Kind() == slog.KindAny {
+		if group, ok := structGroup(attr.Value.Any()); ok {
+			return slog.Attr{Key: attr.Key, Value: group}
+		}
+	}
+
+	return attr
+}
+
+// structGroup returns the exported fields of a struct or pointer to struct
+// as a group. Types that already know how to print themselves, such as
+// time.Time or errors, are left alone.
+func structGroup(value any) (slog.Value, bool) {
+	switch value.(type) {
+	case error, fmt.Stringer, encoding.TextMarshaler, json.Marshaler:
+		return slog.Value{}, false
+	}
+
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return slog.Value{}, false
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return slog.Value{}, false
+	}
+
+	return slog.GroupValue(structAttrs(v)...), true
+}
+
+func structAttrs(v reflect.Value) []slog.Attr {
+	var attrs []slog.Attr
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		// fields of embedded structs are logged as if declared in v
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			attrs = append(attrs, structAttrs(v.Field(i))...)
+			continue
+		}
+
+		// the secret tag of the config package
+		if field.Tag.Get("secret") == "true" {
+			attrs = append(attrs, slog.String(field.Name, redactedValue))
+			continue
+		}
+
+		attrs = append(attrs, slog.Any(field.Name, v.Field(i).Interface()))
+	}
+
+	return attrs
+}
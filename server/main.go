@@ -1,54 +1,379 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
-	"github.com/joho/godotenv"
+	"github.com/go-session/session"
+	"server/accesslog"
+	"server/config"
 	"server/db"
+	"server/form"
+	"server/i18n"
+	"server/lifecycle"
+	"server/logging"
+	"server/password"
+	"server/phone"
+	"server/requestid"
 	"server/routes"
+	"server/sms"
+	"server/template"
+	"server/tlsutil"
 )
 
-func initDBConnection() error {
-	if err := godotenv.Load(); err != nil {
+func initSessions(config config.SessionConfig) {
+	session.InitManager(
+		session.SetCookieName(config.CookieName),
+		session.SetCookieLifeTime(int(config.CookieLifetime.Seconds())),
+		session.SetExpired(int64(config.Expiration.Seconds())),
+		session.SetSecure(config.Secure),
+		session.SetDomain(config.Domain),
+		session.SetStore(routes.TrackSessions(session.NewMemoryStore())),
+	)
+}
+
+func initPasswordPolicy(cfg *config.Config) error {
+	policy := password.DefaultPolicy()
+
+	policy.MinLength = cfg.Password.MinLength
+	policy.MaxLength = cfg.Password.MaxLength
+	policy.RequireLower = cfg.Password.RequireLower
+	policy.RequireUpper = cfg.Password.RequireUpper
+	policy.RequireDigit = cfg.Password.RequireDigit
+	policy.RequireSymbol = cfg.Password.RequireSymbol
+	policy.DisallowPersonalInfo = cfg.Password.DisallowPersonalInfo
+	policy.MinScore = cfg.Password.MinScore
+
+	if cfg.Password.HashAlgorithm == password.AlgorithmBcrypt {
+		policy.MaxBytes = password.BcryptMaxBytes
+	}
+
+	if path := cfg.Password.CommonList; path != "" {
+		if err := policy.LoadCommonPasswords(path); err != nil {
+			return err
+		}
+	}
+
+	if indexPath := cfg.BreachedIndexPath(); indexPath != "" {
+		index, err := password.OpenBreachedIndex(cfg.Password.BreachedSource, indexPath, cfg.Password.BreachedMinCount)
+		if err != nil {
+			return err
+		}
+		policy.AddChecker(index)
+
+		lifecycle.OnShutdown("breached password index", func(context.Context) error {
+			return index.Close()
+		})
+	}
+
+	password.ActivePolicy = policy
+	form.RegisterRule("password", password.FormRule)
+
+	return nil
+}
+
+func initPasswordHashing(cfg *config.Config) error {
+	argon2id := password.DefaultArgon2idHasher()
+	argon2id.Memory = cfg.Password.Argon2Memory
+	argon2id.Iterations = cfg.Password.Argon2Iterations
+	argon2id.Parallelism = cfg.Password.Argon2Parallelism
+
+	bcryptCost := cfg.Password.BcryptCost
+
+	preferred, err := password.NewHasher(cfg.Password.HashAlgorithm, bcryptCost, argon2id)
+	if err != nil {
 		return err
 	}
 
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
+	password.ActiveHashing = password.NewHashing(preferred, argon2id, &password.BcryptHasher{Cost: bcryptCost})
+
+	return nil
+}
+
+func initPhoneNumbers(cfg *config.Config) {
+	phone.DefaultRegion = strings.ToUpper(cfg.Phone.DefaultRegion)
+	form.RegisterRule("phone", phone.FormRule)
+
+	if cfg.SMS.Sender == "webhook" {
+		sms.ActiveSender = sms.NewWebhookSender(cfg.SMS.WebhookURL, cfg.SMS.WebhookToken)
+	} else {
+		sms.ActiveSender = sms.LogSender{}
+	}
+}
+
+// configureTLS makes server serve HTTPS with the certificate of the
+// configuration, reloaded when its files change.
+func configureTLS(cfg *config.Config, server *http.Server) error {
+	reloader, err := tlsutil.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	if err != nil {
+		return err
+	}
 
-	if err := db.HandlerConnector.Open(dbHost, dbPort, dbUser, dbPassword, dbName); err != nil {
+	server.TLSConfig, err = tlsutil.NewConfig(reloader, tlsutil.Options{
+		MinVersion:   cfg.TLS.MinVersion,
+		CipherSuites: cfg.TLS.CipherSuites,
+		ClientCAFile: cfg.TLS.AdminClientCAFile,
+	})
+	if err != nil {
 		return err
 	}
 
+	reloader.Watch(cfg.TLS.ReloadInterval)
+	lifecycle.OnShutdown("tls certificate reloader", func(context.Context) error {
+		reloader.Stop()
+		return nil
+	})
+
+	return nil
+}
+
+// serve runs server until it is shut down, reporting any other failure on
+// serveErr.
+func serve(server *http.Server, serveErr chan<- error) {
+	var err error
+
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+
+	if !errors.Is(err, http.ErrServerClosed) {
+		serveErr <- err
+	}
+}
+
+func shutdownHTTPServer(server *http.Server) lifecycle.Hook {
+	// Shutdown stops accepting connections and waits for the in-flight
+	// requests; those still running at the deadline are cut off
+	return func(ctx context.Context) error {
+		if err := server.Shutdown(ctx); err != nil {
+			_ = server.Close()
+			return err
+		}
+		return nil
+	}
+}
+
+func newHTTPServer(cfg config.ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// openAccessLog returns nil when the access log is disabled. A file is
+// closed on shutdown, after the servers have stopped writing to it.
+func openAccessLog(cfg *config.Config) (*accesslog.Logger, error) {
+	proxies, err := accesslog.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	var output io.Writer
+
+	switch cfg.AccessLog.Output {
+	case "":
+		return nil, nil
+	case "stdout":
+		output = os.Stdout
+	case "stderr":
+		output = os.Stderr
+	default:
+		file, err := accesslog.OpenRotatingFile(cfg.AccessLog.Output, int64(cfg.AccessLog.MaxSize)<<20, cfg.AccessLog.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+
+		lifecycle.OnShutdown("access log", func(context.Context) error {
+			return file.Close()
+		})
+		output = file
+	}
+
+	return accesslog.New(output, cfg.AccessLog.Format, proxies)
+}
+
+// flushLogs makes sure the last log lines reach their destination before
+// the process exits. Sync fails on terminals and pipes, which are not
+// buffered anyway.
+func flushLogs(context.Context) error {
+	_ = os.Stderr.Sync()
 	return nil
 }
 
 func main() {
-	if err := initDBConnection(); err != nil {
+	if err := run(); err != nil {
 		log.Fatal(err)
 	}
+}
 
-	fs := http.FileServer(http.Dir("../public"))
-	http.Handle("/static/", http.StripPrefix("/static/", fs))
+func run() (err error) {
+	cfg, err := config.Load(os.Args[1:])
 
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if cfg.PrintOnly() {
+		fmt.Print(cfg.Redacted())
+		return nil
+	}
+
+	if err = logging.Setup(os.Stderr, cfg.Logging()); err != nil {
+		return err
+	}
+
+	if cfg.File != "" {
+		slog.Info("configuration loaded", "file", cfg.File)
+	}
+
+	// whatever happens from here on, the resources registered so far are
+	// released, last registered first
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+
+		err = errors.Join(err, lifecycle.Shutdown(ctx))
+	}()
+
+	lifecycle.OnShutdown("logs", flushLogs)
+
+	initSessions(cfg.Session)
+
+	if err = db.HandlerConnector.Open(cfg.DB()); err != nil {
+		return err
+	}
+
+	lifecycle.OnShutdown("database", func(context.Context) error {
+		return db.HandlerConnector.Close()
+	})
+
+	if err = i18n.Load(); err != nil {
+		return err
+	}
+
+	if err = initPasswordPolicy(cfg); err != nil {
+		return err
+	}
+
+	if err = initPasswordHashing(cfg); err != nil {
+		return err
+	}
+
+	initPhoneNumbers(cfg)
+	routes.MaxLoginAttempts = cfg.Login.MaxAttempts
+
+	assets := assetsFileSystem(cfg.Server.AssetsDir)
+	template.SetFileSystem(assets)
+
+	if err = template.Load(cfg.Server.DevMode); err != nil {
+		return err
+	}
+
+	lifecycle.OnShutdown("views watcher", template.StopWatching)
+
+	publicAssets, err := fs.Sub(assets, "public")
+	if err != nil {
+		return err
+	}
+
+	if routes.AccessLog, err = openAccessLog(cfg); err != nil {
+		return err
+	}
+
+	var staticHandler http.Handler = http.StripPrefix("/static/", http.FileServer(http.FS(publicAssets)))
+	if routes.AccessLog != nil {
+		staticHandler = requestid.Middleware(routes.AccessLog.Middleware("/static/")(staticHandler))
+	}
+	http.Handle("/static/", staticHandler)
+
+	routes.AdminWithoutClientCert = cfg.Server.InsecureAdmin
+	routes.MetricsOnMainServer = cfg.Metrics.Enabled && cfg.Metrics.Addr == ""
+	routes.MetricsUsername = cfg.Metrics.Username
+	routes.MetricsPassword = cfg.Metrics.Password
 	routes.SetHandlerFunc(routes.InitRouter())
 
-	log.Println("Server listening on http://localhost:5000")
+	handler := tlsutil.HSTS(tlsutil.HSTSOptions{
+		MaxAge:            cfg.TLS.HSTSMaxAge,
+		IncludeSubdomains: cfg.TLS.HSTSIncludeSubdomains,
+		Preload:           cfg.TLS.HSTSPreload,
+	})(http.DefaultServeMux)
 
-	if err := http.ListenAndServe(":5000", nil); err != nil {
-		log.Fatal(err)
+	server := newHTTPServer(cfg.Server, handler)
+	scheme := "http"
+
+	if cfg.TLS.Enabled() {
+		if err = configureTLS(cfg, server); err != nil {
+			return err
+		}
+		scheme = "https"
 	}
 
-	defer func(Handler db.Connector) {
-		err := Handler.Close()
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 3)
+
+	lifecycle.OnShutdown("http server", shutdownHTTPServer(server))
+	go serve(server, serveErr)
+	slog.Info("server listening", "url", scheme+"://"+cfg.Server.Addr)
+
+	if cfg.TLS.Enabled() && cfg.TLS.RedirectAddr != "" {
+		httpsPort, err := tlsutil.Port(cfg.Server.Addr)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-	}(db.HandlerConnector)
 
+		redirectConfig := cfg.Server
+		redirectConfig.Addr = cfg.TLS.RedirectAddr
+		redirectServer := newHTTPServer(redirectConfig, tlsutil.RedirectHandler(httpsPort))
+
+		lifecycle.OnShutdown("http redirect server", shutdownHTTPServer(redirectServer))
+		go serve(redirectServer, serveErr)
+		slog.Info("redirecting to https", "addr", cfg.TLS.RedirectAddr)
+	}
+
+	if cfg.Metrics.Enabled && cfg.Metrics.Addr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle(routes.MetricsPath, routes.MetricsHandler())
+
+		metricsConfig := cfg.Server
+		metricsConfig.Addr = cfg.Metrics.Addr
+		metricsServer := newHTTPServer(metricsConfig, metricsMux)
+
+		lifecycle.OnShutdown("metrics server", shutdownHTTPServer(metricsServer))
+		go serve(metricsServer, serveErr)
+		slog.Info("serving metrics", "url", "http://"+cfg.Metrics.Addr+routes.MetricsPath)
+	}
+
+	select {
+	case err = <-serveErr:
+	case <-signals.Done():
+		slog.Info("shutting down, waiting for in-flight requests", "timeout", cfg.Server.ShutdownTimeout)
+	}
+
+	// a second signal kills the process without waiting
+	stop()
+
+	return err
 }
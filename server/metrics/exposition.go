@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const textContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// WriteText writes families in the Prometheus text exposition format.
+func WriteText(w io.Writer, families []Family) error {
+	out := bufio.NewWriter(w)
+
+	for _, family := range families {
+		out.WriteString("# HELP " + family.Name + " " + helpEscaper.Replace(family.Help) + "\n")
+		out.WriteString("# TYPE " + family.Name + " " + string(family.Type) + "\n")
+
+		for _, sample := range family.Samples {
+			if family.Type != HistogramType {
+				writeSample(out, family.Name, family.LabelNames, sample.LabelValues, "", "", sample.Value)
+				continue
+			}
+
+			// the bucket counts are already cumulative
+			for i, upperBound := range family.Buckets {
+				writeSample(out, family.Name+"_bucket", family.LabelNames, sample.LabelValues, "le", formatFloat(upperBound), float64(sample.Buckets[i]))
+			}
+			writeSample(out, family.Name+"_sum", family.LabelNames, sample.LabelValues, "", "", sample.Sum)
+			writeSample(out, family.Name+"_count", family.LabelNames, sample.LabelValues, "", "", float64(sample.Count))
+		}
+	}
+
+	return out.Flush()
+}
+
+func writeSample(out *bufio.Writer, name string, labelNames, labelValues []string, extraName, extraValue string, value float64) {
+	out.WriteString(name)
+
+	if len(labelNames) > 0 || extraName != "" {
+		out.WriteByte('{')
+		for i, labelName := range labelNames {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			out.WriteString(labelName + `="` + labelValueEscaper.Replace(labelValues[i]) + `"`)
+		}
+		if extraName != "" {
+			if len(labelNames) > 0 {
+				out.WriteByte(',')
+			}
+			out.WriteString(extraName + `="` + extraValue + `"`)
+		}
+		out.WriteByte('}')
+	}
+
+	out.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Handler serves the families of r to Prometheus.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", textContentType)
+		w.Header().Set("Cache-Control", "no-store")
+		_ = WriteText(w, r.Gather())
+	})
+}
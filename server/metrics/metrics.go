@@ -0,0 +1,294 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type MetricType string
+
+const (
+	CounterType   MetricType = "counter"
+	GaugeType     MetricType = "gauge"
+	HistogramType MetricType = "histogram"
+)
+
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Sample is a single labelled value of a family at the time it was gathered.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+	Count       uint64
+	Sum         float64
+	Buckets     []uint64
+}
+
+type Family struct {
+	Name       string
+	Help       string
+	Type       MetricType
+	LabelNames []string
+	Buckets    []float64
+	Samples    []Sample
+}
+
+type collector interface {
+	collect() Family
+}
+
+type Registry struct {
+	collectors map[string]collector
+	mu         sync.Mutex
+}
+
+func newRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.collectors[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.collectors[name] = c
+}
+
+// Gather returns a snapshot of every registered family sorted by name.
+func (r *Registry) Gather() []Family {
+	r.mu.Lock()
+	collectors := make([]collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mu.Unlock()
+
+	families := make([]Family, 0, len(collectors))
+	for _, c := range collectors {
+		families = append(families, c.collect())
+	}
+
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].Name < families[j].Name
+	})
+
+	return families
+}
+
+var Default = newRegistry()
+
+type vec[T any] struct {
+	labelNames []string
+	children   map[string]*child[T]
+	newValue   func() *T
+	mu         sync.Mutex
+}
+
+type child[T any] struct {
+	labelValues []string
+	value       *T
+}
+
+func newVec[T any](labelNames []string, newValue func() *T) vec[T] {
+	return vec[T]{
+		labelNames: labelNames,
+		children:   make(map[string]*child[T]),
+		newValue:   newValue,
+	}
+}
+
+func (v *vec[T]) with(labelValues []string) *T {
+	if len(labelValues) != len(v.labelNames) {
+		panic("metrics: wrong number of label values")
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	c, ok := v.children[key]
+	if !ok {
+		c = &child[T]{labelValues: append([]string(nil), labelValues...), value: v.newValue()}
+		v.children[key] = c
+	}
+
+	return c.value
+}
+
+func (v *vec[T]) each(fn func(labelValues []string, value *T)) {
+	v.mu.Lock()
+	children := make([]*child[T], 0, len(v.children))
+	for _, c := range v.children {
+		children = append(children, c)
+	}
+	v.mu.Unlock()
+
+	sort.Slice(children, func(i, j int) bool {
+		return strings.Join(children[i].labelValues, "\xff") < strings.Join(children[j].labelValues, "\xff")
+	})
+
+	for _, c := range children {
+		fn(c.labelValues, c.value)
+	}
+}
+
+type Counter struct {
+	value float64
+	mu    sync.Mutex
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+
+	c.mu.Lock()
+	c.value += delta
+	c.mu.Unlock()
+}
+
+func (c *Counter) get() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+type CounterVec struct {
+	name string
+	help string
+	vec[Counter]
+}
+
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{
+		name: name,
+		help: help,
+		vec:  newVec(labelNames, func() *Counter { return &Counter{} }),
+	}
+	Default.register(name, c)
+	return c
+}
+
+func (c *CounterVec) With(labelValues ...string) *Counter {
+	return c.with(labelValues)
+}
+
+func (c *CounterVec) collect() Family {
+	family := Family{Name: c.name, Help: c.help, Type: CounterType, LabelNames: c.labelNames}
+	c.each(func(labelValues []string, counter *Counter) {
+		family.Samples = append(family.Samples, Sample{LabelValues: labelValues, Value: counter.get()})
+	})
+	return family
+}
+
+type Histogram struct {
+	upperBounds []float64
+	buckets     []uint64
+	count       uint64
+	sum         float64
+	mu          sync.Mutex
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upperBound := range h.upperBounds {
+		if value <= upperBound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func (h *Histogram) snapshot() (buckets []uint64, count uint64, sum float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]uint64(nil), h.buckets...), h.count, h.sum
+}
+
+type HistogramVec struct {
+	name    string
+	help    string
+	buckets []float64
+	vec[Histogram]
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	upperBounds := append([]float64(nil), buckets...)
+	sort.Float64s(upperBounds)
+	if len(upperBounds) == 0 || !math.IsInf(upperBounds[len(upperBounds)-1], 1) {
+		upperBounds = append(upperBounds, math.Inf(1))
+	}
+
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		buckets: upperBounds,
+	}
+	h.vec = newVec(labelNames, func() *Histogram {
+		return &Histogram{upperBounds: upperBounds, buckets: make([]uint64, len(upperBounds))}
+	})
+	Default.register(name, h)
+	return h
+}
+
+func (h *HistogramVec) With(labelValues ...string) *Histogram {
+	return h.with(labelValues)
+}
+
+func (h *HistogramVec) collect() Family {
+	family := Family{Name: h.name, Help: h.help, Type: HistogramType, LabelNames: h.labelNames, Buckets: h.buckets}
+	h.each(func(labelValues []string, histogram *Histogram) {
+		buckets, count, sum := histogram.snapshot()
+		family.Samples = append(family.Samples, Sample{LabelValues: labelValues, Count: count, Sum: sum, Buckets: buckets})
+	})
+	return family
+}
+
+// GaugeFunc reports the values returned by fn each time the registry is gathered.
+type GaugeFunc struct {
+	name       string
+	help       string
+	labelNames []string
+	fn         func() []Sample
+}
+
+func NewGaugeFunc(name, help string, fn func() []Sample, labelNames ...string) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, labelNames: labelNames, fn: fn}
+	Default.register(name, g)
+	return g
+}
+
+func (g *GaugeFunc) collect() Family {
+	return Family{Name: g.name, Help: g.help, Type: GaugeType, LabelNames: g.labelNames, Samples: g.fn()}
+}
+
+// CounterFunc reports the totals returned by fn each time the registry is
+// gathered, for counters kept by someone else such as database/sql.
+type CounterFunc struct {
+	name       string
+	help       string
+	labelNames []string
+	fn         func() []Sample
+}
+
+func NewCounterFunc(name, help string, fn func() []Sample, labelNames ...string) *CounterFunc {
+	c := &CounterFunc{name: name, help: help, labelNames: labelNames, fn: fn}
+	Default.register(name, c)
+	return c
+}
+
+func (c *CounterFunc) collect() Family {
+	return Family{Name: c.name, Help: c.help, Type: CounterType, LabelNames: c.labelNames, Samples: c.fn()}
+}
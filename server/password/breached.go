@@ -0,0 +1,311 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"server/errs"
+)
+
+/*
+ * The breached password index is a binary file built once from the
+ * "Pwned Passwords" downloads, either the single file ordered by hash with
+ * lines "SHA1:COUNT", or a directory of range files named after the 5 hex
+ * characters prefix with lines "SUFFIX:COUNT". Its layout is:
+ *
+ *   magic (8 bytes) | record count (uint64)
+ *   fan-out table: 65537 uint64, index of the first record of each 2 bytes prefix
+ *   records: 20 bytes SHA-1 digest + uint32 count, sorted by digest
+ *
+ * Only the fan-out table is kept in memory; lookups binary search the
+ * records of one bucket on disk.
+ */
+
+const (
+	indexMagic      = "PWNIDX1\n"
+	fanOutSize      = 1 << 16
+	digestSize      = sha1.Size
+	recordSize      = digestSize + 4
+	headerSize      = len(indexMagic) + 8
+	fanOutTableSize = (fanOutSize + 1) * 8
+	rangePrefixSize = 5
+)
+
+type BreachedIndex struct {
+	file     *os.File
+	fanOut   []uint64
+	minCount uint32
+}
+
+// OpenBreachedIndex opens the index at indexPath, building it first from
+// source when it does not exist or is older than source.
+func OpenBreachedIndex(source, indexPath string, minCount int) (*BreachedIndex, error) {
+	if source != "" && indexIsStale(source, indexPath) {
+		slog.Info("building breached password index", "index", indexPath, "source", source)
+
+		if err := BuildBreachedIndex(source, indexPath); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerSize+fanOutTableSize)
+	if _, err = io.ReadFull(file, header); err != nil || string(header[:len(indexMagic)]) != indexMagic {
+		_ = file.Close()
+		return nil, fmt.Errorf("%s: %s", indexPath, errs.BreachedIndexInvalidError)
+	}
+
+	fanOut := make([]uint64, fanOutSize+1)
+	for i := range fanOut {
+		fanOut[i] = binary.BigEndian.Uint64(header[headerSize+i*8:])
+	}
+
+	if minCount < 1 {
+		minCount = 1
+	}
+
+	return &BreachedIndex{file: file, fanOut: fanOut, minCount: uint32(minCount)}, nil
+}
+
+func indexIsStale(source, indexPath string) bool {
+	indexInfo, err := os.Stat(indexPath)
+	if err != nil {
+		return true
+	}
+
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return false
+	}
+
+	return sourceInfo.ModTime().After(indexInfo.ModTime())
+}
+
+func (b *BreachedIndex) Close() error {
+	return b.file.Close()
+}
+
+// Count returns how many times the password appears in the breaches.
+func (b *BreachedIndex) Count(password string) (int, error) {
+	digest := sha1.Sum([]byte(password))
+	bucket := int(binary.BigEndian.Uint16(digest[:2]))
+
+	low, high := b.fanOut[bucket], b.fanOut[bucket+1]
+	record := make([]byte, recordSize)
+
+	var searchErr error
+	i := sort.Search(int(high-low), func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+
+		offset := int64(headerSize+fanOutTableSize) + int64(low+uint64(i))*recordSize
+		if _, err := b.file.ReadAt(record, offset); err != nil {
+			searchErr = err
+			return true
+		}
+
+		return bytes.Compare(record[:digestSize], digest[:]) >= 0
+	})
+
+	if searchErr != nil {
+		return 0, searchErr
+	}
+
+	if uint64(i) == high-low {
+		return 0, nil
+	}
+
+	offset := int64(headerSize+fanOutTableSize) + int64(low+uint64(i))*recordSize
+	if _, err := b.file.ReadAt(record, offset); err != nil {
+		return 0, err
+	}
+
+	if !bytes.Equal(record[:digestSize], digest[:]) {
+		return 0, nil
+	}
+
+	return int(binary.BigEndian.Uint32(record[digestSize:])), nil
+}
+
+// Check implements Checker. Lookup failures are logged and let the password
+// through, so a damaged index never blocks signups.
+func (b *BreachedIndex) Check(password string) *Violation {
+	count, err := b.Count(password)
+	if err != nil {
+		slog.Error("breached password lookup failed", "error", err)
+		return nil
+	}
+
+	if count < int(b.minCount) {
+		return nil
+	}
+
+	return &Violation{Rule: RuleBreached, Message: errs.PasswordBreachedError, Args: []any{count}}
+}
+
+type indexWriter struct {
+	out      *bufio.Writer
+	fanOut   []uint64
+	count    uint64
+	previous []byte
+}
+
+func (w *indexWriter) add(digest []byte, count uint32) error {
+	if w.previous != nil && bytes.Compare(digest, w.previous) <= 0 {
+		return errors.New(errs.BreachedSourceNotSortedError)
+	}
+	w.previous = append(w.previous[:0], digest...)
+
+	w.fanOut[int(binary.BigEndian.Uint16(digest[:2]))+1]++
+
+	var countBytes [4]byte
+	binary.BigEndian.PutUint32(countBytes[:], count)
+
+	if _, err := w.out.Write(digest); err != nil {
+		return err
+	}
+	if _, err := w.out.Write(countBytes[:]); err != nil {
+		return err
+	}
+
+	w.count++
+	return nil
+}
+
+// BuildBreachedIndex writes the index of source to indexPath. The entries
+// of source must be sorted by hash, as they are in the official downloads.
+func BuildBreachedIndex(source, indexPath string) error {
+	tmpPath := indexPath + ".tmp"
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	defer file.Close()
+
+	// the header is written last, once the record count and fan-out are known
+	if _, err = file.Seek(int64(headerSize+fanOutTableSize), io.SeekStart); err != nil {
+		return err
+	}
+
+	w := &indexWriter{out: bufio.NewWriterSize(file, 1<<20), fanOut: make([]uint64, fanOutSize+1)}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		err = readRangeDirectory(source, w)
+	} else {
+		err = readHashFile(source, "", w)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = w.out.Flush(); err != nil {
+		return err
+	}
+
+	header := make([]byte, headerSize+fanOutTableSize)
+	copy(header, indexMagic)
+	binary.BigEndian.PutUint64(header[len(indexMagic):], w.count)
+
+	var cumulative uint64
+	for i := range w.fanOut {
+		cumulative += w.fanOut[i]
+		binary.BigEndian.PutUint64(header[headerSize+i*8:], cumulative)
+	}
+
+	if _, err = file.WriteAt(header, 0); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, indexPath)
+}
+
+func readRangeDirectory(dir string, w *indexWriter) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// ReadDir returns the entries sorted by file name, hence by prefix
+	for _, entry := range entries {
+		prefix := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if entry.IsDir() || len(prefix) != rangePrefixSize {
+			continue
+		}
+
+		if err = readHashFile(filepath.Join(dir, entry.Name()), strings.ToUpper(prefix), w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readHashFile reads "HASH:COUNT" lines, where HASH is completed with
+// prefix for range files.
+func readHashFile(path, prefix string, w *indexWriter) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		hash, countText, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("%s:%d: %s", path, lineNumber, errs.BreachedSourceInvalidLineError)
+		}
+
+		digest, err := hex.DecodeString(prefix + hash)
+		if err != nil || len(digest) != digestSize {
+			return fmt.Errorf("%s:%d: %s", path, lineNumber, errs.BreachedSourceInvalidLineError)
+		}
+
+		count, err := strconv.ParseUint(strings.TrimSpace(countText), 10, 32)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", path, lineNumber, errs.BreachedSourceInvalidLineError)
+		}
+
+		if err = w.add(digest, uint32(count)); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+	}
+
+	return scanner.Err()
+}
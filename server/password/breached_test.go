@@ -0,0 +1,117 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// hashes of "pw119577", "password", "123456" and "pw49421", the first and
+// last in the buckets 0x0000 and 0xFFFF at both ends of the fan-out table
+const breachedSource = `000086F7BBBFC7E0579D21BBACE0CCEADE50A56C:7
+5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824
+7C4A8D09CA3762AF61E59520943DC26494F8941B:37359195
+FFFFE1217A540D51245793248F1D807B397EC07D:3
+`
+
+func openTestIndex(t *testing.T, source string, minCount int) *BreachedIndex {
+	t.Helper()
+
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "pwned.txt")
+	if err := os.WriteFile(sourcePath, []byte(source), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := OpenBreachedIndex(sourcePath, sourcePath+".idx", minCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { index.Close() })
+
+	return index
+}
+
+func TestBreachedIndexCount(t *testing.T) {
+	index := openTestIndex(t, breachedSource, 1)
+
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{"pw119577", 7},
+		{"password", 9545824},
+		{"123456", 37359195},
+		{"pw49421", 3},
+		{"not breached", 0},
+	}
+
+	for _, test := range tests {
+		got, err := index.Count(test.password)
+		if err != nil {
+			t.Fatalf("Count(%q): %v", test.password, err)
+		}
+		if got != test.want {
+			t.Errorf("Count(%q) = %d, want %d", test.password, got, test.want)
+		}
+	}
+}
+
+func TestBreachedIndexRangeDirectory(t *testing.T) {
+	dir := t.TempDir()
+	rangeDir := filepath.Join(dir, "range")
+	if err := os.Mkdir(rangeDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Fields(breachedSource) {
+		prefix, suffix := line[:rangePrefixSize], line[rangePrefixSize:]
+		if err := os.WriteFile(filepath.Join(rangeDir, prefix+".txt"), []byte(suffix+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index, err := OpenBreachedIndex(rangeDir, filepath.Join(dir, "range.idx"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+
+	for password, want := range map[string]int{"pw119577": 7, "pw49421": 3} {
+		if got, err := index.Count(password); err != nil || got != want {
+			t.Errorf("Count(%q) = %d, %v, want %d", password, got, err, want)
+		}
+	}
+}
+
+func TestBreachedIndexCheckMinCount(t *testing.T) {
+	index := openTestIndex(t, breachedSource, 5)
+
+	if violation := index.Check("pw49421"); violation != nil {
+		t.Errorf("Check(pw49421) = %+v, want nil under the minimum count", violation)
+	}
+	if violation := index.Check("pw119577"); violation == nil || violation.Rule != RuleBreached {
+		t.Errorf("Check(pw119577) = %+v, want a %s violation", violation, RuleBreached)
+	}
+}
+
+func TestBuildBreachedIndexRejectsBadSources(t *testing.T) {
+	tests := map[string]string{
+		"unsorted":      "FFFFE1217A540D51245793248F1D807B397EC07D:3\n000086F7BBBFC7E0579D21BBACE0CCEADE50A56C:7\n",
+		"missing count": "000086F7BBBFC7E0579D21BBACE0CCEADE50A56C\n",
+		"short hash":    "000086F7:7\n",
+	}
+
+	for name, source := range tests {
+		dir := t.TempDir()
+		sourcePath := filepath.Join(dir, "pwned.txt")
+		if err := os.WriteFile(sourcePath, []byte(source), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := BuildBreachedIndex(sourcePath, sourcePath+".idx"); err == nil {
+			t.Errorf("%s: BuildBreachedIndex succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"server/errs"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// BcryptMaxBytes is the longest password bcrypt accepts, in bytes.
+const BcryptMaxBytes = 72
+
+// Bounds of the Argon2id parameters, checked on the hashes read back from
+// the database too, so that a forged or corrupted hash cannot exhaust the
+// memory or CPU of the server at login.
+const (
+	MaxArgon2Memory      = 1 << 20 // KiB, 1 GiB
+	MaxArgon2Iterations  = 16
+	MaxArgon2Parallelism = 64
+
+	minArgon2SaltLength = 8
+	maxArgon2SaltLength = 64
+	minArgon2KeyLength  = 16
+	maxArgon2KeyLength  = 128
+)
+
+// Hasher hashes passwords into a self-describing encoded string: the PHC
+// string format for Argon2id and the modular crypt format for bcrypt, so
+// that every stored hash carries the parameters it was made with.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded. A mismatch is not an error.
+	Verify(password, encoded string) (bool, error)
+	// Identifies reports whether encoded was produced by this algorithm.
+	Identifies(encoded string) bool
+	// NeedsRehash reports whether encoded uses other parameters than the hasher.
+	NeedsRehash(encoded string) bool
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h *BcryptHasher) Identifies(encoded string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(encoded, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher parameters follow RFC 9106, Memory is in KiB.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func DefaultArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 4,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+const argon2idPrefix = "$" + AlgorithmArgon2id + "$"
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+type argon2idHash struct {
+	version     int
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func decodeArgon2id(encoded string) (*argon2idHash, error) {
+	// "", "argon2id", "v=19", "m=65536,t=3,p=4", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return nil, errors.New(errs.InvalidPasswordHashError)
+	}
+
+	var hash argon2idHash
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &hash.version); err != nil {
+		return nil, errors.New(errs.InvalidPasswordHashError)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.memory, &hash.iterations, &hash.parallelism); err != nil {
+		return nil, errors.New(errs.InvalidPasswordHashError)
+	}
+
+	var err error
+	if hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, errors.New(errs.InvalidPasswordHashError)
+	}
+	if hash.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, errors.New(errs.InvalidPasswordHashError)
+	}
+
+	if !hash.inBounds() {
+		return nil, errors.New(errs.InvalidPasswordHashError)
+	}
+
+	return &hash, nil
+}
+
+func (h *argon2idHash) inBounds() bool {
+	return h.parallelism >= 1 && h.parallelism <= MaxArgon2Parallelism &&
+		h.iterations >= 1 && h.iterations <= MaxArgon2Iterations &&
+		h.memory >= 8*uint32(h.parallelism) && h.memory <= MaxArgon2Memory &&
+		len(h.salt) >= minArgon2SaltLength && len(h.salt) <= maxArgon2SaltLength &&
+		len(h.key) >= minArgon2KeyLength && len(h.key) <= maxArgon2KeyLength
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	hash, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	if hash.version != argon2.Version {
+		return false, errors.New(errs.InvalidPasswordHashError)
+	}
+
+	key := argon2.IDKey([]byte(password), hash.salt, hash.iterations, hash.memory, hash.parallelism, uint32(len(hash.key)))
+
+	return subtle.ConstantTimeCompare(key, hash.key) == 1, nil
+}
+
+func (h *Argon2idHasher) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	hash, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+
+	return hash.version != argon2.Version ||
+		hash.memory != h.Memory ||
+		hash.iterations != h.Iterations ||
+		hash.parallelism != h.Parallelism ||
+		uint32(len(hash.salt)) != h.SaltLength ||
+		uint32(len(hash.key)) != h.KeyLength
+}
+
+// Hashing hashes new passwords with Preferred and still verifies the hashes
+// of every other known algorithm, flagging them for an upgrade.
+type Hashing struct {
+	Preferred Hasher
+	Known     []Hasher
+}
+
+func NewHashing(preferred Hasher, known ...Hasher) *Hashing {
+	return &Hashing{Preferred: preferred, Known: known}
+}
+
+func DefaultHashing() *Hashing {
+	return NewHashing(DefaultArgon2idHasher(), &BcryptHasher{Cost: bcrypt.DefaultCost})
+}
+
+// NewHasher returns the hasher of algorithm, either argon2id or bcrypt
+// with the given cost.
+func NewHasher(algorithm string, bcryptCost int, argon2id *Argon2idHasher) (Hasher, error) {
+	switch algorithm {
+	case AlgorithmArgon2id:
+		return argon2id, nil
+	case AlgorithmBcrypt:
+		return &BcryptHasher{Cost: bcryptCost}, nil
+	default:
+		return nil, fmt.Errorf("%s: %q", errs.UnknownHashAlgorithmError, algorithm)
+	}
+}
+
+// ActiveHashing is used for every password stored or checked at login.
+var ActiveHashing = DefaultHashing()
+
+func (h *Hashing) Hash(password string) (string, error) {
+	return h.Preferred.Hash(password)
+}
+
+// Verify checks password against encoded whatever the algorithm it uses.
+// rehash is true when the password matches but encoded should be replaced
+// by a fresh hash of the preferred algorithm.
+func (h *Hashing) Verify(password, encoded string) (ok bool, rehash bool, err error) {
+	hasher := h.hasherFor(encoded)
+	if hasher == nil {
+		return false, false, errors.New(errs.InvalidPasswordHashError)
+	}
+
+	if ok, err = hasher.Verify(password, encoded); err != nil || !ok {
+		return false, false, err
+	}
+
+	return true, hasher != h.Preferred || h.Preferred.NeedsRehash(encoded), nil
+}
+
+func (h *Hashing) hasherFor(encoded string) Hasher {
+	if h.Preferred.Identifies(encoded) {
+		return h.Preferred
+	}
+
+	for _, hasher := range h.Known {
+		if hasher.Identifies(encoded) {
+			return hasher
+		}
+	}
+
+	return nil
+}
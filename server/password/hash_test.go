@@ -0,0 +1,168 @@
+package password
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheap parameters, the defaults take a noticeable time per hash
+func testArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+}
+
+func testHashers() map[string]Hasher {
+	return map[string]Hasher{
+		AlgorithmArgon2id: testArgon2idHasher(),
+		AlgorithmBcrypt:   &BcryptHasher{Cost: bcrypt.MinCost},
+	}
+}
+
+func TestHasherHashAndVerify(t *testing.T) {
+	for name, hasher := range testHashers() {
+		encoded, err := hasher.Hash("correct horse")
+		if err != nil {
+			t.Fatalf("%s: Hash: %v", name, err)
+		}
+
+		if !hasher.Identifies(encoded) {
+			t.Errorf("%s: does not identify its own hash %q", name, encoded)
+		}
+		if hasher.NeedsRehash(encoded) {
+			t.Errorf("%s: NeedsRehash(own hash) = true", name)
+		}
+
+		if ok, err := hasher.Verify("correct horse", encoded); !ok || err != nil {
+			t.Errorf("%s: Verify(right password) = %v, %v", name, ok, err)
+		}
+		if ok, err := hasher.Verify("wrong horse", encoded); ok || err != nil {
+			t.Errorf("%s: Verify(wrong password) = %v, %v, want false without error", name, ok, err)
+		}
+	}
+}
+
+func TestHashersIdentifyOnlyTheirHashes(t *testing.T) {
+	argon2id := testArgon2idHasher()
+	bcryptHasher := &BcryptHasher{Cost: bcrypt.MinCost}
+
+	argon2idHash, _ := argon2id.Hash("secret")
+	bcryptHash, _ := bcryptHasher.Hash("secret")
+
+	if argon2id.Identifies(bcryptHash) || bcryptHasher.Identifies(argon2idHash) {
+		t.Error("a hasher identifies the hash of the other algorithm")
+	}
+}
+
+func TestArgon2idHashFormat(t *testing.T) {
+	encoded, err := testArgon2idHasher().Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" || parts[2] != "v=19" || parts[3] != "m=64,t=1,p=1" {
+		t.Fatalf("hash %q is not in the PHC string format", encoded)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) != 16 {
+		t.Errorf("salt %q: %d bytes, %v", parts[4], len(salt), err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) != 32 {
+		t.Errorf("key %q: %d bytes, %v", parts[5], len(key), err)
+	}
+}
+
+func TestNeedsRehashWhenParametersChange(t *testing.T) {
+	argon2id := testArgon2idHasher()
+	encoded, _ := argon2id.Hash("secret")
+
+	stronger := testArgon2idHasher()
+	stronger.Iterations = 2
+	if !stronger.NeedsRehash(encoded) {
+		t.Error("argon2id: NeedsRehash = false after raising the iterations")
+	}
+
+	bcryptHash, _ := (&BcryptHasher{Cost: bcrypt.MinCost}).Hash("secret")
+	if !(&BcryptHasher{Cost: bcrypt.MinCost + 1}).NeedsRehash(bcryptHash) {
+		t.Error("bcrypt: NeedsRehash = false after raising the cost")
+	}
+}
+
+func TestArgon2idVerifyRejectsOutOfBoundsParameters(t *testing.T) {
+	salt := base64.RawStdEncoding.EncodeToString(make([]byte, 16))
+	key := base64.RawStdEncoding.EncodeToString(make([]byte, 32))
+
+	tests := map[string]string{
+		"no parallelism":    "m=64,t=1,p=0",
+		"no iterations":     "m=64,t=0,p=1",
+		"too little memory": "m=4,t=1,p=1",
+		"too much memory":   fmt.Sprintf("m=%d,t=1,p=1", MaxArgon2Memory+1),
+		"too many passes":   fmt.Sprintf("m=64,t=%d,p=1", MaxArgon2Iterations+1),
+		"too many lanes":    fmt.Sprintf("m=%d,t=1,p=%d", 8*(MaxArgon2Parallelism+1), MaxArgon2Parallelism+1),
+	}
+
+	hasher := testArgon2idHasher()
+	for name, parameters := range tests {
+		encoded := "$argon2id$v=19$" + parameters + "$" + salt + "$" + key
+
+		if ok, err := hasher.Verify("secret", encoded); ok || err == nil {
+			t.Errorf("%s: Verify = %v, %v, want an error", name, ok, err)
+		}
+	}
+
+	short := "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + base64.RawStdEncoding.EncodeToString(make([]byte, 4))
+	if _, err := hasher.Verify("secret", short); err == nil {
+		t.Error("Verify accepted a 4 bytes key")
+	}
+}
+
+func TestBcryptRefusesLongPasswords(t *testing.T) {
+	_, err := (&BcryptHasher{Cost: bcrypt.MinCost}).Hash(strings.Repeat("a", BcryptMaxBytes+1))
+	if !errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		t.Errorf("Hash(73 bytes) error = %v, want %v", err, bcrypt.ErrPasswordTooLong)
+	}
+}
+
+func TestHashingVerifyFlagsRehash(t *testing.T) {
+	argon2id := testArgon2idHasher()
+	bcryptHasher := &BcryptHasher{Cost: bcrypt.MinCost}
+	hashing := NewHashing(argon2id, bcryptHasher)
+
+	bcryptHash, _ := bcryptHasher.Hash("secret")
+	if ok, rehash, err := hashing.Verify("secret", bcryptHash); !ok || !rehash || err != nil {
+		t.Errorf("Verify(bcrypt hash) = %v, %v, %v, want a match to rehash", ok, rehash, err)
+	}
+
+	argon2idHash, _ := hashing.Hash("secret")
+	if ok, rehash, err := hashing.Verify("secret", argon2idHash); !ok || rehash || err != nil {
+		t.Errorf("Verify(preferred hash) = %v, %v, %v, want a match to keep", ok, rehash, err)
+	}
+
+	if ok, rehash, err := hashing.Verify("wrong", bcryptHash); ok || rehash || err != nil {
+		t.Errorf("Verify(wrong password) = %v, %v, %v", ok, rehash, err)
+	}
+
+	if _, _, err := hashing.Verify("secret", "plaintext"); err == nil {
+		t.Error("Verify(unknown hash) succeeded")
+	}
+}
+
+func TestPolicyMaxBytes(t *testing.T) {
+	policy := &Policy{MinLength: 1, MaxLength: 72, MaxBytes: BcryptMaxBytes}
+
+	// 40 runes, 80 bytes
+	violations := policy.Check(strings.Repeat("é", 40), Subject{})
+	if len(violations) != 1 || violations[0].Rule != RuleTooLong {
+		t.Errorf("Check(80 bytes) = %+v, want a single %s violation", violations, RuleTooLong)
+	}
+
+	if violations := policy.Check(strings.Repeat("é", 36), Subject{}); len(violations) != 0 {
+		t.Errorf("Check(72 bytes) = %+v, want none", violations)
+	}
+}
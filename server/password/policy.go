@@ -0,0 +1,262 @@
+package password
+
+import (
+	"bufio"
+	"embed"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"server/errs"
+)
+
+const (
+	RuleTooShort         = "too_short"
+	RuleTooLong          = "too_long"
+	RuleMissingLower     = "missing_lower"
+	RuleMissingUpper     = "missing_upper"
+	RuleMissingDigit     = "missing_digit"
+	RuleMissingSymbol    = "missing_symbol"
+	RuleContainsEmail    = "contains_email"
+	RuleContainsUsername = "contains_username"
+	RuleCommon           = "common"
+	RuleWeak             = "weak"
+	RuleBreached         = "breached"
+
+	MaxScore = 4
+)
+
+//go:embed common.txt
+var embeddedCommonPasswords embed.FS
+
+// Violation is a policy rule the password breaks. Message is the catalog
+// key shown to the user and Args the values it is formatted with.
+type Violation struct {
+	Rule    string
+	Message string
+	Args    []any
+}
+
+// Subject is what is known about the account the password belongs to, so
+// that the password cannot simply repeat it.
+type Subject struct {
+	Email    string
+	Username string
+}
+
+type Policy struct {
+	MinLength            int
+	MaxLength            int
+	RequireLower         bool
+	RequireUpper         bool
+	RequireDigit         bool
+	RequireSymbol        bool
+	DisallowPersonalInfo bool
+	MinScore             int
+
+	// MaxBytes limits the UTF-8 length of the password, for hashes that
+	// accept no more, such as bcrypt. 0 is no limit.
+	MaxBytes int
+
+	commonPasswords map[string]struct{}
+	checkers        []Checker
+}
+
+// Checker is an extra rule plugged into a policy, such as the breached
+// password index.
+type Checker interface {
+	Check(password string) *Violation
+}
+
+func DefaultPolicy() *Policy {
+	policy := &Policy{
+		MinLength:            8,
+		MaxLength:            128,
+		DisallowPersonalInfo: true,
+		MinScore:             2,
+	}
+
+	if err := policy.loadEmbeddedCommonPasswords(); err != nil {
+		panic(err)
+	}
+
+	return policy
+}
+
+// ActivePolicy is the policy applied to every password set by a user.
+var ActivePolicy = DefaultPolicy()
+
+func (p *Policy) AddChecker(checker Checker) {
+	p.checkers = append(p.checkers, checker)
+}
+
+func (p *Policy) loadEmbeddedCommonPasswords() error {
+	file, err := embeddedCommonPasswords.Open("common.txt")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return p.readCommonPasswords(file)
+}
+
+// LoadCommonPasswords adds the passwords listed one per line in path to the
+// list of rejected common passwords.
+func (p *Policy) LoadCommonPasswords(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return p.readCommonPasswords(file)
+}
+
+func (p *Policy) readCommonPasswords(r io.Reader) error {
+	if p.commonPasswords == nil {
+		p.commonPasswords = make(map[string]struct{})
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			p.commonPasswords[strings.ToLower(line)] = struct{}{}
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (p *Policy) IsCommon(password string) bool {
+	_, ok := p.commonPasswords[strings.ToLower(password)]
+	return ok
+}
+
+type characterClasses struct {
+	lower, upper, digit, symbol bool
+}
+
+func (c characterClasses) count() int {
+	count := 0
+	for _, present := range []bool{c.lower, c.upper, c.digit, c.symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+func classify(password string) characterClasses {
+	var classes characterClasses
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			classes.lower = true
+		case unicode.IsUpper(r):
+			classes.upper = true
+		case unicode.IsDigit(r):
+			classes.digit = true
+		default:
+			classes.symbol = true
+		}
+	}
+
+	return classes
+}
+
+// Score rates the password from 0 (trivial) to MaxScore (strong) using its
+// length in runes, the variety of characters and whether it is a known
+// common password.
+func (p *Policy) Score(password string) int {
+	if p.IsCommon(password) {
+		return 0
+	}
+
+	length := utf8.RuneCountInString(password)
+	score := 0
+
+	switch {
+	case length >= 16:
+		score += 3
+	case length >= 12:
+		score += 2
+	case length >= 8:
+		score++
+	}
+
+	switch classes := classify(password).count(); {
+	case classes >= 3:
+		score += 2
+	case classes == 2:
+		score++
+	}
+
+	if score > MaxScore {
+		score = MaxScore
+	}
+	return score
+}
+
+// Check returns every rule of the policy the password breaks, most
+// fundamental first.
+func (p *Policy) Check(password string, subject Subject) []Violation {
+	var violations []Violation
+	length := utf8.RuneCountInString(password)
+
+	if length < p.MinLength {
+		violations = append(violations, Violation{RuleTooShort, errs.PasswordTooShortError, []any{p.MinLength, length}})
+	}
+
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, Violation{RuleTooLong, errs.PasswordTooLongError, []any{p.MaxLength, length}})
+	} else if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		violations = append(violations, Violation{RuleTooLong, errs.PasswordTooLongBytesError, []any{p.MaxBytes, len(password)}})
+	}
+
+	classes := classify(password)
+
+	if p.RequireLower && !classes.lower {
+		violations = append(violations, Violation{Rule: RuleMissingLower, Message: errs.PasswordMissingLowerError})
+	}
+	if p.RequireUpper && !classes.upper {
+		violations = append(violations, Violation{Rule: RuleMissingUpper, Message: errs.PasswordMissingUpperError})
+	}
+	if p.RequireDigit && !classes.digit {
+		violations = append(violations, Violation{Rule: RuleMissingDigit, Message: errs.PasswordMissingDigitError})
+	}
+	if p.RequireSymbol && !classes.symbol {
+		violations = append(violations, Violation{Rule: RuleMissingSymbol, Message: errs.PasswordMissingSymbolError})
+	}
+
+	if p.DisallowPersonalInfo {
+		lowerPassword := strings.ToLower(password)
+		localPart, _, _ := strings.Cut(strings.ToLower(subject.Email), "@")
+
+		if len(localPart) >= 3 && strings.Contains(lowerPassword, localPart) {
+			violations = append(violations, Violation{Rule: RuleContainsEmail, Message: errs.PasswordContainsEmailError})
+		}
+
+		username := strings.ToLower(strings.TrimSpace(subject.Username))
+		if len(username) >= 3 && strings.Contains(lowerPassword, username) {
+			violations = append(violations, Violation{Rule: RuleContainsUsername, Message: errs.PasswordContainsUsernameError})
+		}
+	}
+
+	if p.IsCommon(password) {
+		violations = append(violations, Violation{Rule: RuleCommon, Message: errs.PasswordCommonError})
+	} else if score := p.Score(password); score < p.MinScore {
+		violations = append(violations, Violation{RuleWeak, errs.PasswordWeakError, []any{score, MaxScore}})
+	}
+
+	for _, checker := range p.checkers {
+		if violation := checker.Check(password); violation != nil {
+			violations = append(violations, *violation)
+		}
+	}
+
+	return violations
+}
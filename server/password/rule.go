@@ -0,0 +1,35 @@
+package password
+
+import (
+	"reflect"
+
+	"server/form"
+)
+
+const (
+	emailFieldName    = "Email"
+	usernameFieldName = "Username"
+)
+
+// FormRule validates a field against ActivePolicy. The Email and Username
+// fields of the same struct, when present, are used as the Subject.
+func FormRule(rc form.RuleContext) *form.Failure {
+	violations := ActivePolicy.Check(rc.String(), Subject{
+		Email:    stringField(rc.Struct, emailFieldName),
+		Username: stringField(rc.Struct, usernameFieldName),
+	})
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return &form.Failure{Message: violations[0].Message, Args: violations[0].Args}
+}
+
+func stringField(structValue reflect.Value, name string) string {
+	field := structValue.FieldByName(name)
+	if !field.IsValid() || field.Kind() != reflect.String {
+		return ""
+	}
+	return field.String()
+}
@@ -0,0 +1,246 @@
+package phone
+
+import (
+	"embed"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"server/errs"
+)
+
+const (
+	maxCallingCodeLength = 3
+	maxE164Digits        = 15
+)
+
+//go:embed metadata.json
+var embeddedMetadata embed.FS
+
+// Country describes the numbering plan of a region: its calling code, the
+// allowed lengths of the national significant number and the trunk prefix
+// dialed before it inside the country.
+type Country struct {
+	Region      string `json:"-"`
+	CallingCode string `json:"code"`
+	Lengths     []int  `json:"lengths"`
+	TrunkPrefix string `json:"trunk"`
+	// Main marks the region chosen for a calling code shared by several.
+	Main bool `json:"main"`
+}
+
+func (c *Country) validLength(length int) bool {
+	for _, allowed := range c.Lengths {
+		if allowed == length {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	countries     map[string]*Country
+	byCallingCode map[string][]*Country
+	regions       []string
+	DefaultRegion = "US"
+)
+
+func init() {
+	data, err := embeddedMetadata.ReadFile("metadata.json")
+	if err != nil {
+		panic(err)
+	}
+
+	if err = json.Unmarshal(data, &countries); err != nil {
+		panic(err)
+	}
+
+	byCallingCode = make(map[string][]*Country)
+
+	for region, country := range countries {
+		country.Region = region
+		regions = append(regions, region)
+
+		if country.Main {
+			byCallingCode[country.CallingCode] = append([]*Country{country}, byCallingCode[country.CallingCode]...)
+		} else {
+			byCallingCode[country.CallingCode] = append(byCallingCode[country.CallingCode], country)
+		}
+	}
+
+	sort.Strings(regions)
+}
+
+// Regions returns the supported region codes, sorted.
+func Regions() []string {
+	return append([]string(nil), regions...)
+}
+
+func Lookup(region string) (*Country, bool) {
+	country, ok := countries[strings.ToUpper(strings.TrimSpace(region))]
+	return country, ok
+}
+
+func IsSupportedRegion(region string) bool {
+	_, ok := Lookup(region)
+	return ok
+}
+
+// Error is a parsing failure. Message is a catalog key formatted with Args.
+type Error struct {
+	Message string
+	Args    []any
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+type Number struct {
+	Region      string
+	CallingCode string
+	National    string
+}
+
+// E164 returns the number as "+<calling code><national number>", the form
+// phone numbers are stored and compared in.
+func (n *Number) E164() string {
+	return "+" + n.CallingCode + n.National
+}
+
+func (n *Number) String() string {
+	return n.E164()
+}
+
+// Parse reads a phone number written in any usual way: with a leading "+"
+// or "00" followed by the calling code, or as a national number of region,
+// with or without its trunk prefix. Spaces, dashes, dots, slashes and
+// parentheses are ignored.
+func Parse(input, region string) (*Number, error) {
+	digits, international, ok := clean(input)
+	if !ok || digits == "" {
+		return nil, &Error{Message: errs.PhoneInvalidError}
+	}
+
+	if region == "" {
+		region = DefaultRegion
+	}
+	home, hasHome := Lookup(region)
+
+	if !international && hasHome && home.CallingCode == "1" && strings.HasPrefix(digits, "011") {
+		// international prefix of the North American numbering plan
+		digits, international = digits[3:], true
+	}
+
+	if international {
+		return parseInternational(digits, home)
+	}
+
+	if !hasHome {
+		return nil, &Error{Message: errs.PhoneUnknownCountryError}
+	}
+
+	if number, ok := parseNational(digits, home); ok {
+		return number, nil
+	}
+
+	// the calling code may have been typed without the leading "+"
+	if strings.HasPrefix(digits, home.CallingCode) {
+		if number, ok := parseNational(digits[len(home.CallingCode):], home); ok {
+			return number, nil
+		}
+	}
+
+	return nil, lengthError(home)
+}
+
+// Normalize parses input and returns its E.164 form.
+func Normalize(input, region string) (string, error) {
+	number, err := Parse(input, region)
+	if err != nil {
+		return "", err
+	}
+	return number.E164(), nil
+}
+
+func IsValid(input, region string) bool {
+	_, err := Parse(input, region)
+	return err == nil
+}
+
+func clean(input string) (digits string, international bool, ok bool) {
+	input = strings.TrimSpace(input)
+
+	if strings.HasPrefix(input, "+") {
+		input, international = input[1:], true
+	}
+
+	var builder strings.Builder
+
+	for _, r := range input {
+		switch {
+		case r >= '0' && r <= '9':
+			builder.WriteRune(r)
+		case strings.ContainsRune(" \u00a0-./()", r):
+		default:
+			return "", false, false
+		}
+	}
+
+	digits = builder.String()
+	if !international && strings.HasPrefix(digits, "00") {
+		digits, international = digits[2:], true
+	}
+
+	return digits, international, true
+}
+
+func parseInternational(digits string, home *Country) (*Number, error) {
+	if len(digits) > maxE164Digits {
+		return nil, &Error{Message: errs.PhoneInvalidError}
+	}
+
+	for length := 1; length <= maxCallingCodeLength && length < len(digits); length++ {
+		candidates := byCallingCode[digits[:length]]
+		if len(candidates) == 0 {
+			continue
+		}
+
+		country := candidates[0]
+		if home != nil && home.CallingCode == country.CallingCode {
+			country = home
+		}
+
+		if number, ok := parseNational(digits[length:], country); ok {
+			return number, nil
+		}
+
+		return nil, lengthError(country)
+	}
+
+	return nil, &Error{Message: errs.PhoneUnknownCountryError}
+}
+
+func parseNational(digits string, country *Country) (*Number, bool) {
+	prefix := country.TrunkPrefix
+
+	// the trunk prefix is dropped only when what follows is a whole number,
+	// since some national numbers may start with the same digit
+	if prefix != "" && strings.HasPrefix(digits, prefix) && country.validLength(len(digits)-len(prefix)) {
+		digits = digits[len(prefix):]
+	} else if !country.validLength(len(digits)) {
+		return nil, false
+	}
+
+	return &Number{Region: country.Region, CallingCode: country.CallingCode, National: digits}, true
+}
+
+func lengthError(country *Country) error {
+	lengths := make([]string, len(country.Lengths))
+	for i, length := range country.Lengths {
+		lengths[i] = strconv.Itoa(length)
+	}
+
+	return &Error{Message: errs.PhoneLengthError, Args: []any{country.Region, strings.Join(lengths, ", ")}}
+}
@@ -0,0 +1,112 @@
+package phone
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"server/errs"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input, region string
+		wantRegion    string
+		wantE164      string
+	}{
+		{"+1 (415) 555-0132", "US", "US", "+14155550132"},
+		{"415.555.0132", "US", "US", "+14155550132"},
+		{"1 415 555 0132", "US", "US", "+14155550132"},
+		{"011 44 20 7946 0958", "US", "GB", "+442079460958"},
+		{"0044 20 7946 0958", "DE", "GB", "+442079460958"},
+		{"020 7946 0958", "GB", "GB", "+442079460958"},
+		{"44 20 7946 0958", "gb", "GB", "+442079460958"},
+		{"+44 (0)20 7946 0958", "US", "GB", "+442079460958"},
+		{"+49 30 123456", "", "DE", "+4930123456"},
+		{" +34 612 345 678 ", "US", "ES", "+34612345678"},
+		// a calling code shared by several regions keeps the home region
+		{"+1 809 555 0100", "DO", "DO", "+18095550100"},
+		{"+1 809 555 0100", "GB", "US", "+18095550100"},
+	}
+
+	for _, test := range tests {
+		number, err := Parse(test.input, test.region)
+		if err != nil {
+			t.Errorf("Parse(%q, %q): %v", test.input, test.region, err)
+			continue
+		}
+
+		if number.Region != test.wantRegion || number.E164() != test.wantE164 {
+			t.Errorf("Parse(%q, %q) = %s in %s, want %s in %s",
+				test.input, test.region, number.E164(), number.Region, test.wantE164, test.wantRegion)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input, region string
+		want          Error
+	}{
+		{"", "US", Error{Message: errs.PhoneInvalidError}},
+		{"415-555-abcd", "US", Error{Message: errs.PhoneInvalidError}},
+		{"+1234567890123456", "US", Error{Message: errs.PhoneInvalidError}},
+		{"555 0132", "US", Error{Message: errs.PhoneLengthError, Args: []any{"US", "10"}}},
+		{"+44 20 7946", "US", Error{Message: errs.PhoneLengthError, Args: []any{"GB", "9, 10"}}},
+		{"+999 123456", "US", Error{Message: errs.PhoneUnknownCountryError}},
+		{"0123456", "XX", Error{Message: errs.PhoneUnknownCountryError}},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.input, test.region)
+
+		var phoneErr *Error
+		if !errors.As(err, &phoneErr) {
+			t.Errorf("Parse(%q, %q) error = %v, want %+v", test.input, test.region, err, test.want)
+			continue
+		}
+
+		if !reflect.DeepEqual(*phoneErr, test.want) {
+			t.Errorf("Parse(%q, %q) error = %+v, want %+v", test.input, test.region, *phoneErr, test.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	normalized, err := Normalize("(415) 555-0132", "US")
+	if err != nil || normalized != "+14155550132" {
+		t.Errorf("Normalize = %q, %v, want +14155550132", normalized, err)
+	}
+
+	// the stored form parses back to itself whatever the region
+	again, err := Normalize(normalized, "FR")
+	if err != nil || again != normalized {
+		t.Errorf("Normalize(%q) = %q, %v", normalized, again, err)
+	}
+
+	if IsValid("555", "US") {
+		t.Error("IsValid(555) = true")
+	}
+}
+
+func TestRegionsMatchLookup(t *testing.T) {
+	regions := Regions()
+	if len(regions) == 0 {
+		t.Fatal("no regions")
+	}
+
+	for i, region := range regions {
+		if i > 0 && regions[i-1] >= region {
+			t.Errorf("regions not sorted: %q before %q", regions[i-1], region)
+		}
+
+		country, ok := Lookup(region)
+		if !ok || country.Region != region || country.CallingCode == "" || len(country.Lengths) == 0 {
+			t.Errorf("Lookup(%q) = %+v, %v", region, country, ok)
+		}
+	}
+
+	if main := byCallingCode["1"][0]; main.Region != "US" {
+		t.Errorf("calling code 1 resolves to %s, want the main region US", main.Region)
+	}
+}
@@ -0,0 +1,37 @@
+package phone
+
+import (
+	"errors"
+	"reflect"
+
+	"server/form"
+)
+
+// FormRule validates a field holding a phone number. Its optional param
+// names the field of the same struct holding the region; DefaultRegion is
+// used otherwise. Empty values are left to the required rule.
+func FormRule(rc form.RuleContext) *form.Failure {
+	value := rc.String()
+	if value == "" {
+		return nil
+	}
+
+	region := ""
+	if rc.Param != "" {
+		if field := rc.Struct.FieldByName(rc.Param); field.IsValid() && field.Kind() == reflect.String {
+			region = field.String()
+		}
+	}
+
+	_, err := Parse(value, region)
+	if err == nil {
+		return nil
+	}
+
+	var phoneErr *Error
+	if errors.As(err, &phoneErr) {
+		return &form.Failure{Message: phoneErr.Message, Args: phoneErr.Args}
+	}
+
+	return &form.Failure{Message: err.Error()}
+}
@@ -0,0 +1,62 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+const (
+	HeaderName  = "X-Request-ID"
+	maxIDLength = 128
+)
+
+type contextKey struct{}
+
+func New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// isValid accepts the IDs set by proxies in front of the server as long as
+// they are short and printable, so they are safe to echo and to log.
+func isValid(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Middleware assigns every request an ID, reusing the one received in the
+// X-Request-ID header when valid, and echoes it in the response.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderName)
+		if !isValid(id) {
+			id = New()
+		}
+
+		w.Header().Set(HeaderName, id)
+		next.ServeHTTP(w, r.WithContext(WithID(r.Context(), id)))
+	})
+}
@@ -63,6 +63,15 @@ func (r *Router) GetRouteByMethod(path string, method HTTPMethod) *Route {
 	return nil
 }
 
+func (r *Router) GetAllowedMethods(path string) []string {
+	var methods []string
+
+	for _, route := range r.pathRoutes[path] {
+		methods = append(methods, route.method.ToString())
+	}
+	return methods
+}
+
 func (r *Router) GetPathRoutes() *map[string]Routes {
 	return &r.pathRoutes
 }
@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/go-session/session"
+	"server/errs"
+	"server/template"
+)
+
+// formFlashKey is the session key of the form state flashed to path. The
+// outcome of a failed submission is kept in the session of its user until
+// the page it redirects to renders it once.
+func formFlashKey(path string) string {
+	return "flash:" + path
+}
+
+// redirectWithFormState flashes state to path and redirects there.
+func redirectWithFormState(w http.ResponseWriter, r *http.Request, path string, state *template.PageFormErrors) {
+	store, err := session.Start(r.Context(), w, r)
+
+	if err != nil {
+		errs.Render(w, r, err, path)
+		return
+	}
+
+	state.EnableErrorView(state.HasErrors())
+	store.Set(formFlashKey(path), *state)
+
+	if err = store.Save(); err != nil {
+		errs.Render(w, r, err, path)
+		return
+	}
+
+	http.Redirect(w, r, path, http.StatusSeeOther)
+}
+
+// takeFormState returns the form state flashed to path, empty if there is
+// none, and removes it from the session.
+func takeFormState(w http.ResponseWriter, r *http.Request, path string) (template.PageFormErrors, error) {
+	var state template.PageFormErrors
+
+	store, err := session.Start(r.Context(), w, r)
+
+	if err != nil {
+		return state, err
+	}
+
+	flashed, ok := store.Get(formFlashKey(path))
+
+	if !ok {
+		return state, nil
+	}
+
+	state = flashed.(template.PageFormErrors)
+	store.Delete(formFlashKey(path))
+
+	return state, store.Save()
+}
@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"server/db"
+	"server/logging"
+	"server/routerutils"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+type poolStats struct {
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`
+	WaitDuration       string `json:"wait_duration"`
+	MaxIdleClosed      int64  `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64  `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64  `json:"max_lifetime_closed"`
+}
+
+type healthStatus struct {
+	Status   string     `json:"status"`
+	Database string     `json:"database,omitempty"`
+	Pool     *poolStats `json:"pool,omitempty"`
+}
+
+// liveHandlerGet answers as long as the server serves requests, whatever the
+// state of the database, for the probes that restart the process.
+func liveHandlerGet(w http.ResponseWriter, r *http.Request) {
+	writeHealthStatus(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// healthHandlerGet reports whether the database answers. It is open to the
+// probes, the pool statistics are only added for admin requests.
+func healthHandlerGet(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	status := healthStatus{Status: "ok", Database: "up"}
+	statusCode := http.StatusOK
+
+	if err := db.HandlerConnector.Ping(ctx); err != nil {
+		slog.WarnContext(ctx, "health check: database unreachable", logging.Err(err))
+		status.Status = "unavailable"
+		status.Database = "unavailable"
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	if !isAdminRequest(r) {
+		writeHealthStatus(w, statusCode, status)
+		return
+	}
+
+	if stats, err := db.HandlerConnector.Stats(); err == nil {
+		status.Pool = &poolStats{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDuration:       stats.WaitDuration.String(),
+			MaxIdleClosed:      stats.MaxIdleClosed,
+			MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		}
+	}
+
+	writeHealthStatus(w, statusCode, status)
+}
+
+func writeHealthStatus(w http.ResponseWriter, statusCode int, status healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+func initHealthRouter(router *routerutils.Router) {
+	router.Get(HealthPath, healthHandlerGet, nil)
+	router.Get(LivePath, liveHandlerGet, nil)
+}
@@ -9,10 +9,10 @@ import (
 )
 
 func homeHandlerGet(w http.ResponseWriter, r *http.Request) {
-	_, err := template.Render(w, nil, template.GetView("index"), template.GetLayout("home"))
+	_, err := template.Render(w, r, nil, template.GetPage("home"))
 
 	if err != nil {
-		errs.InternalServerErrorHandler(w, err, HomePath)
+		errs.Render(w, r, err, HomePath)
 	}
 }
 
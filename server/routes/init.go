@@ -2,7 +2,13 @@ package routes
 
 import (
 	"net/http"
+	"strings"
 
+	"server/accesslog"
+	"server/errs"
+	"server/i18n"
+	"server/logging"
+	"server/requestid"
 	"server/routerutils"
 )
 
@@ -11,6 +17,15 @@ const (
 	LoginPath   = "/login"
 	SignupPath  = "/signup"
 	RecoverPath = "/login/recover"
+	HealthPath  = "/health"
+	LivePath    = "/health/live"
+	LocalePath  = "/lang"
+	MetricsPath = "/metrics"
+
+	PhonePath       = "/account/phone"
+	PhoneVerifyPath = "/account/phone/verify"
+	PhoneResendPath = "/account/phone/resend"
+	PhoneRemovePath = "/account/phone/remove"
 )
 
 func InitRouter() *routerutils.Router {
@@ -20,6 +35,10 @@ func InitRouter() *routerutils.Router {
 	initLoginRouter(router)
 	initSignupRouter(router)
 	initRecoverRouter(router)
+	initHealthRouter(router)
+	initLocaleRouter(router)
+	initPhoneRouter(router)
+	initMetricsRouter(router)
 
 	return router
 }
@@ -36,13 +55,36 @@ func processRoute(w http.ResponseWriter, r *http.Request, route *routerutils.Rou
 
 func configureRouteHandler(path string, router *routerutils.Router) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// "/" is also the fallback pattern of http.ServeMux for every
+		// unregistered path
+		if r.URL.Path != path {
+			errs.RenderStatus(w, r, http.StatusNotFound, HomePath)
+			return
+		}
+
 		route := router.GetRouteByMethod(path, routerutils.HTTPMethod(r.Method))
+
+		if route == nil {
+			w.Header().Set("Allow", strings.Join(router.GetAllowedMethods(path), ", "))
+			errs.RenderStatus(w, r, http.StatusMethodNotAllowed, path)
+			return
+		}
+
 		processRoute(w, r, route)
 	})
 }
 
+// AccessLog records the requests of every route when set.
+var AccessLog *accesslog.Logger
+
 func setupRoutes(path string, router *routerutils.Router) {
-	http.Handle(path, configureRouteHandler(path, router))
+	handler := instrumentMiddleware(path)(i18n.Middleware(recoverMiddleware(configureRouteHandler(path, router))))
+
+	if AccessLog != nil {
+		handler = AccessLog.Middleware(path)(handler)
+	}
+
+	http.Handle(path, requestid.Middleware(logging.Middleware(handler)))
 }
 
 func SetHandlerFunc(router *routerutils.Router) {
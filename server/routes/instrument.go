@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/form"
+	"server/metrics"
+)
+
+const (
+	loginResultSuccess = "success"
+	loginResultFailure = "failure"
+	loginResultLocked  = "locked"
+
+	recoveryMethodUnknown = "unknown"
+)
+
+var (
+	requestsTotal = metrics.NewCounterVec(
+		"http_requests_total",
+		"Number of HTTP requests served, by route, method and status.",
+		"route", "method", "status",
+	)
+	requestDuration = metrics.NewHistogramVec(
+		"http_request_duration_seconds",
+		"Latency of HTTP requests, by route and method.",
+		metrics.DefaultDurationBuckets,
+		"route", "method",
+	)
+	loginsTotal = metrics.NewCounterVec(
+		"auth_logins_total",
+		"Number of login attempts, by result: success, failure or locked for an already locked account.",
+		"result",
+	)
+	lockoutsTotal = metrics.NewCounterVec(
+		"auth_lockouts_total",
+		"Number of accounts locked after too many failed logins.",
+	)
+	signupsTotal = metrics.NewCounterVec(
+		"auth_signups_total",
+		"Number of accounts created.",
+	)
+	recoveryRequestsTotal = metrics.NewCounterVec(
+		"auth_recovery_requests_total",
+		"Number of account recovery requests, by method and whether an account matched.",
+		"method", "result",
+	)
+)
+
+// recoveryMethodLabel keeps the method label to the known methods, a value
+// matching neither an email nor a phone is counted as unknown.
+func recoveryMethodLabel(method form.RecoveryMethodType) string {
+	if method != form.RecoveryMethodEmail && method != form.RecoveryMethodPhone {
+		return recoveryMethodUnknown
+	}
+	return string(method)
+}
+
+// instrumentMiddleware records the requests served by next under route,
+// the pattern next is registered for, so that unknown paths do not create
+// new series.
+func instrumentMiddleware(route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			tw := &trackingResponseWriter{ResponseWriter: w}
+
+			defer func() {
+				status := tw.status
+				if status == 0 {
+					status = http.StatusOK
+				}
+
+				// only the methods of the router, anything else is answered 405
+				method := r.Method
+				if method != http.MethodGet && method != http.MethodPost && method != http.MethodHead {
+					method = "other"
+				}
+
+				requestsTotal.With(route, method, strconv.Itoa(status)).Inc()
+				requestDuration.With(route, method).Observe(time.Since(start).Seconds())
+			}()
+
+			next.ServeHTTP(tw, r)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"net/http"
+	"net/url"
+
+	"server/i18n"
+	"server/routerutils"
+)
+
+const localeQueryParam = "lang"
+
+func localeHandlerGet(w http.ResponseWriter, r *http.Request) {
+	locale := r.URL.Query().Get(localeQueryParam)
+
+	if i18n.IsSupported(locale) {
+		i18n.SetLocaleCookie(w, locale)
+	}
+
+	http.Redirect(w, r, localeRedirectTarget(r), http.StatusSeeOther)
+}
+
+// localeRedirectTarget sends the user back to the page they came from, as
+// long as it belongs to this site.
+func localeRedirectTarget(r *http.Request) string {
+	referer, err := url.Parse(r.Referer())
+	if err != nil || referer.Path == "" || (referer.Host != "" && referer.Host != r.Host) {
+		return HomePath
+	}
+
+	return referer.RequestURI()
+}
+
+func initLocaleRouter(router *routerutils.Router) {
+	router.Get(LocalePath, localeHandlerGet, nil)
+}
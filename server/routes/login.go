@@ -2,159 +2,205 @@ package routes
 
 import (
 	"context"
-	"database/sql"
 	"errors"
-	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/go-session/session"
-	"golang.org/x/crypto/bcrypt"
 	"server/db"
 	"server/errs"
 	"server/form"
+	"server/i18n"
+	"server/logging"
+	"server/password"
 	"server/routerutils"
 	"server/template"
-	"server/utils"
 )
 
-const maxLoginAttempts = 2
-
-var templateLoginData = &template.LoginPageData{}
+// MaxLoginAttempts is the number of failed logins allowed before the
+// account is locked.
+var MaxLoginAttempts = 2
 
 func loginHandlerGet(w http.ResponseWriter, r *http.Request) {
-	_, err := template.Render(w, templateLoginData, template.GetView("index"), template.GetLayout("login"))
+	state, err := takeFormState(w, r, LoginPath)
 
 	if err != nil {
-		errs.InternalServerErrorHandler(w, err, LoginPath)
+		errs.Render(w, r, err, LoginPath)
+		return
 	}
 
-	templateLoginData.EnableErrorView(false)
-	templateLoginData.ClearErrors()
+	data := &template.LoginPageData{}
+	data.FillDefault()
+	data.PageFormErrors = state
+
+	_, err = template.Render(w, r, data, template.GetPage("login"))
+
+	if err != nil {
+		errs.Render(w, r, err, LoginPath)
+	}
 }
 
 func loginHandlerPost(w http.ResponseWriter, r *http.Request) {
 	connection, err := db.HandlerConnector.GetConnection()
 
 	if err != nil {
-		log.Fatal(err)
+		errs.Render(w, r, errs.Unavailable(err), LoginPath)
+		return
 	}
 
-	loginFormFields, ok, err := validateLoginFormFields(r)
+	state := &template.PageFormErrors{}
+	loginFormFields, ok, err := validateLoginFormFields(r, state)
 
 	if err != nil {
-		errs.InternalServerErrorHandler(w, err, LoginPath)
+		errs.Render(w, r, err, LoginPath)
 		return
 	}
 
 	if !ok {
-		templateLoginData.EnableErrorView(true)
-		http.Redirect(w, r, LoginPath, http.StatusSeeOther)
+		redirectWithFormState(w, r, LoginPath, state)
 		return
 	}
 
-	user, err := getUserByEmail(connection, loginFormFields.Email)
+	ctx := r.Context()
+	userKey := userConsistencyKey(loginFormFields.Email)
+
+	// the lock and the failed attempts must be current, a lagging replica
+	// would let a locked account in
+	user, err := getUserByEmail(ctx, connection, loginFormFields.Email)
 
 	if err != nil {
-		handleUserLookupError(w, r, loginFormFields.Email, err)
+		handleUserLookupError(w, r, state, loginFormFields.Email, err)
 		return
 	}
 
 	if user.IsLocked {
-		dealWithBlockedAccount()
-		http.Redirect(w, r, LoginPath, http.StatusSeeOther)
+		rejectLockedLogin(w, r, state)
 		return
 	}
 
-	if err = compareHashPassword(user.Password, loginFormFields.Password); err != nil {
-		handlePasswordComparisonError(w, r, connection, err, user.UserId)
+	rehash, err := compareHashPassword(user.Password, loginFormFields.Password)
+
+	if err != nil {
+		handlePasswordComparisonError(w, r, state, connection, err, user.UserId, userKey)
 		return
 	}
 
-	if err = startSession(w, r, user.UserId); err != nil {
-		errs.InternalServerErrorHandler(w, err, LoginPath)
+	// the account may have been locked by a concurrent failed login since it
+	// was read, the session is only started once it is known not to be
+	isLocked, err := resetLoginAttempts(ctx, connection, user.UserId)
+
+	if err != nil {
+		errs.Render(w, r, err, LoginPath)
+		return
+	}
+
+	if isLocked {
+		rejectLockedLogin(w, r, state)
 		return
 	}
 
-	if err = resetLoginAttempts(connection, user.UserId); err != nil {
-		errs.InternalServerErrorHandler(w, err, LoginPath)
+	if err = startSession(w, r, user.UserId); err != nil {
+		errs.Render(w, r, err, LoginPath)
 		return
 	}
 
+	loginsTotal.With(loginResultSuccess).Inc()
+
+	if rehash {
+		// the login must not fail because the upgrade did, the old hash stays valid
+		if err = upgradePasswordHash(ctx, connection, user, loginFormFields.Password); err != nil {
+			slog.WarnContext(ctx, "password hash upgrade failed", logging.Err(err))
+		}
+	}
+
+	db.HandlerConnector.MarkWrite(userKey)
+
 	http.Redirect(w, r, HomePath, http.StatusSeeOther)
 }
 
-func resetLoginAttempts(connection *sql.DB, userId int) error {
-	_, err := connection.Exec("UPDATE users SET login_attempts = 0 WHERE user_id = ?", userId)
-	return err
+func rejectLockedLogin(w http.ResponseWriter, r *http.Request, state *template.PageFormErrors) {
+	loginsTotal.With(loginResultLocked).Inc()
+	dealWithBlockedAccount(state, i18n.FromContext(r.Context()))
+	redirectWithFormState(w, r, LoginPath, state)
 }
 
-func incrementLoginAttempts(connection *sql.DB, userId int) error {
-	_, err := connection.Exec("UPDATE users SET login_attempts = login_attempts + 1 WHERE user_id = ?", userId)
-	return err
-}
+// resetLoginAttempts clears the failed attempts of an account that is not
+// locked, and reports whether it is.
+func resetLoginAttempts(ctx context.Context, connection *db.DB, userId int) (bool, error) {
+	var isLocked bool
 
-func loginAttemptHandler(connection *sql.DB, userId int) (bool, error) {
-	if err := incrementLoginAttempts(connection, userId); err != nil {
-		return false, err
-	}
+	ctx, cancel := db.HandlerConnector.WithQueryTimeout(ctx)
+	defer cancel()
+
+	err := db.WithTransaction(ctx, connection, func(tx *db.Tx) error {
+		if err := tx.QueryRowContext(ctx, "SELECT is_locked FROM users WHERE user_id = ? FOR UPDATE", userId).Scan(&isLocked); err != nil {
+			return err
+		}
+
+		if isLocked {
+			return nil
+		}
+
+		_, err := tx.ExecContext(ctx, "UPDATE users SET login_attempts = 0 WHERE user_id = ?", userId)
+		return err
+	})
 
-	return checkAndLockAccount(connection, userId)
+	return isLocked, err
 }
 
-func dealWithBlockedAccount() {
-	templateLoginData.EnableErrorView(true)
-	templateLoginData.PushError(fmt.Sprintf(errs.AccountBlockedError, RecoverPath))
+func loginAttemptHandler(ctx context.Context, connection *db.DB, userId int) (bool, error) {
+	var isLocked bool
+
+	ctx, cancel := db.HandlerConnector.WithQueryTimeout(ctx)
+	defer cancel()
+
+	err := db.WithTransaction(ctx, connection, func(tx *db.Tx) error {
+		var err error
+		isLocked, err = registerFailedLoginAttempt(ctx, tx, userId)
+		return err
+	})
+
+	return isLocked, err
 }
 
-func checkAndLockAccount(connection *sql.DB, userId int) (bool, error) {
+func registerFailedLoginAttempt(ctx context.Context, tx *db.Tx, userId int) (bool, error) {
 	var (
 		loginAttempts int
 		isLocked      bool
-		err           error
 	)
 
-	if err = connection.QueryRow("SELECT login_attempts FROM users WHERE user_id=?", userId).Scan(&loginAttempts); err != nil {
+	if err := tx.QueryRowContext(
+		ctx,
+		"SELECT login_attempts, is_locked FROM users WHERE user_id=? FOR UPDATE", userId,
+	).Scan(&loginAttempts, &isLocked); err != nil {
 		return false, err
 	}
 
-	if loginAttempts > maxLoginAttempts {
-		if _, err = connection.Exec("UPDATE users SET is_locked = 1 WHERE user_id=?", userId); err != nil {
-			return false, err
-		}
-
-		isLocked, err = isAccountBlocked(connection, userId)
-
-		if err != nil {
-			return false, err
-		}
-
-		if isLocked {
-			dealWithBlockedAccount()
-		}
+	loginAttempts++
+	isLocked = isLocked || loginAttempts > MaxLoginAttempts
 
+	if _, err := tx.ExecContext(
+		ctx,
+		"UPDATE users SET login_attempts = ?, is_locked = ? WHERE user_id=?", loginAttempts, isLocked, userId,
+	); err != nil {
+		return false, err
 	}
 
 	return isLocked, nil
 }
 
-func isAccountBlocked(connection *sql.DB, userId int) (bool, error) {
-	var isLocked bool
-
-	if err := connection.QueryRow("SELECT is_locked FROM users WHERE user_id=?", userId).Scan(&isLocked); err != nil {
-		return false, err
-	}
-
-	return isLocked, nil
+func dealWithBlockedAccount(state *template.PageFormErrors, locale string) {
+	state.PushHTMLError(template.HTML(i18n.T(locale, errs.AccountBlockedError, RecoverPath)))
 }
 
 func startSession(w http.ResponseWriter, r *http.Request, userId int) error {
-	store, err := session.Start(context.Background(), w, r)
+	store, err := session.Start(r.Context(), w, r)
 	if err != nil {
 		return err
 	}
 
 	store.Set("user_id", userId)
+	logging.SetUserID(r.Context(), userId)
 
 	if err = store.Save(); err != nil {
 		return err
@@ -163,40 +209,81 @@ func startSession(w http.ResponseWriter, r *http.Request, userId int) error {
 	return nil
 }
 
-func compareHashPassword(hashedPassword, password string) error {
-	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)); err != nil {
+func compareHashPassword(hashedPassword, plainPassword string) (bool, error) {
+	ok, rehash, err := password.ActiveHashing.Verify(plainPassword, hashedPassword)
+
+	if err != nil {
+		return false, err
+	}
+
+	if !ok {
+		return false, errs.New(errs.CodeInvalidCredentials, http.StatusUnauthorized, errs.InvalidCredentialsError)
+	}
+
+	return rehash, nil
+}
+
+// upgradePasswordHash replaces the stored hash of user with one made with the
+// current algorithm and parameters, unless it changed since it was read.
+func upgradePasswordHash(ctx context.Context, connection *db.DB, user *form.User, plainPassword string) error {
+	hashedPassword, err := password.ActiveHashing.Hash(plainPassword)
+
+	if err != nil {
 		return err
 	}
-	return nil
+
+	ctx, cancel := db.HandlerConnector.WithQueryTimeout(ctx)
+	defer cancel()
+
+	_, err = connection.ExecContext(
+		ctx,
+		"UPDATE users SET password = ? WHERE user_id = ? AND password = ?", hashedPassword, user.UserId, user.Password,
+	)
+	return err
 }
 
-func handlePasswordComparisonError(w http.ResponseWriter, r *http.Request, connection *sql.DB, err error, userId int) {
-	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-		isLocked, err := loginAttemptHandler(connection, userId)
+func handlePasswordComparisonError(w http.ResponseWriter, r *http.Request, state *template.PageFormErrors, connection *db.DB, err error, userId int, userKey string) {
+	appErr := errs.FromError(err)
+
+	if appErr.Code == errs.CodeInvalidCredentials {
+		loginsTotal.With(loginResultFailure).Inc()
+		isLocked, err := loginAttemptHandler(r.Context(), connection, userId)
 
 		if err != nil {
-			errs.InternalServerErrorHandler(w, err, LoginPath)
+			errs.Render(w, r, err, LoginPath)
 			return
 		}
 
+		if isLocked {
+			lockoutsTotal.With().Inc()
+			dealWithBlockedAccount(state, i18n.FromContext(r.Context()))
+		}
+
+		db.HandlerConnector.MarkWrite(userKey)
+
 		if !isLocked {
-			templateLoginData.EnableErrorView(true)
-			templateLoginData.PushError(fmt.Sprintf(errs.IncorrectPasswordError, maxLoginAttempts))
+			state.PushFieldError(form.PasswordFieldName, i18n.TN(
+				i18n.FromContext(r.Context()), errs.IncorrectPasswordError, MaxLoginAttempts, MaxLoginAttempts,
+			))
 		}
 
-		http.Redirect(w, r, LoginPath, http.StatusSeeOther)
+		redirectWithFormState(w, r, LoginPath, state)
 		return
 	}
 
-	errs.InternalServerErrorHandler(w, err, LoginPath)
+	errs.Render(w, r, appErr, LoginPath)
 }
 
-func getUserByEmail(connection *sql.DB, email string) (*form.User, error) {
-	query := "SELECT * FROM users WHERE email=?"
+func getUserByEmail(ctx context.Context, connection *db.DB, email string) (*form.User, error) {
+	query := "SELECT user_id, username, email, password, login_attempts, is_locked, COALESCE(phone_id, 0) " +
+		"FROM users WHERE email = ?"
 
 	var user form.User
 
-	if err := connection.QueryRow(query, email).Scan(
+	ctx, cancel := db.HandlerConnector.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := connection.QueryRowContext(ctx, query, email).Scan(
 		&user.UserId, &user.Username, &user.Email, &user.Password, &user.LoginAttempts, &user.IsLocked, &user.PhoneId,
 	); err != nil {
 		return nil, err
@@ -205,43 +292,40 @@ func getUserByEmail(connection *sql.DB, email string) (*form.User, error) {
 	return &user, nil
 }
 
-func handleUserLookupError(w http.ResponseWriter, r *http.Request, email string, err error) {
-	if errors.Is(err, sql.ErrNoRows) {
-		templateLoginData.EnableErrorView(true)
-		templateLoginData.PushError(fmt.Sprintf(errs.NoUserFoundError, email))
-		http.Redirect(w, r, LoginPath, http.StatusSeeOther)
+func handleUserLookupError(w http.ResponseWriter, r *http.Request, state *template.PageFormErrors, email string, err error) {
+	appErr := errs.FromError(err)
+
+	if appErr.Code == errs.CodeNotFound {
+		loginsTotal.With(loginResultFailure).Inc()
+		state.PushFieldError(form.EmailFieldName, i18n.T(i18n.FromContext(r.Context()), errs.NoUserFoundError, email))
+		redirectWithFormState(w, r, LoginPath, state)
 	} else {
-		errs.InternalServerErrorHandler(w, err, LoginPath)
+		errs.Render(w, r, appErr, LoginPath)
 	}
 }
 
-func getLoginFormFields(r *http.Request) (*form.LoginFormFields, error) {
-	if err := r.ParseForm(); err != nil {
-		return nil, err
+func validateLoginFormFields(r *http.Request, state *template.PageFormErrors) (*form.LoginFormFields, bool, error) {
+	loginFormFields := &form.LoginFormFields{}
+
+	if err := form.Bind(r, loginFormFields); err != nil {
+		return nil, false, errs.BadRequest(err)
 	}
 
-	return &form.LoginFormFields{
-		Email:    r.Form.Get(form.EmailFieldName),
-		Password: r.Form.Get(form.PasswordFieldName),
-	}, nil
-}
+	state.SetValues(map[string]string{
+		form.EmailFieldName: loginFormFields.Email,
+	})
 
-func validateLoginFormFields(r *http.Request) (*form.LoginFormFields, bool, error) {
-	loginFormFields, err := getLoginFormFields(r)
+	if err := form.Validate(loginFormFields); err != nil {
+		var validationErrors form.ValidationErrors
 
-	if err != nil {
-		return nil, false, nil
-	}
-
-	if !utils.IsValidEmail(loginFormFields.Email) {
-		templateLoginData.PushError(fmt.Sprintf(errs.InvalidEmailError, loginFormFields.Email))
-	}
+		if !errors.As(err, &validationErrors) {
+			return nil, false, err
+		}
 
-	if utils.IsEmptyStr(loginFormFields.Password) {
-		templateLoginData.PushError(errs.EmptyPasswordError)
+		state.PushFieldErrors(validationErrors, i18n.FromContext(r.Context()))
 	}
 
-	if templateLoginData.HasErrors() {
+	if state.HasErrors() {
 		return nil, false, nil
 	}
 
@@ -249,7 +333,10 @@ func validateLoginFormFields(r *http.Request) (*form.LoginFormFields, bool, erro
 }
 
 func initLoginRouter(router *routerutils.Router) {
-	templateLoginData.FillDefault()
 	router.Get(LoginPath, loginHandlerGet, denyAccessIfAlreadyLoggedInMiddleware)
 	router.Post(LoginPath, loginHandlerPost, nil)
 }
+
+func userConsistencyKey(email string) string {
+	return "user:" + email
+}
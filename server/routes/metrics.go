@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"net/http"
+
+	"server/metrics"
+	"server/routerutils"
+)
+
+// MetricsOnMainServer serves /metrics next to the other routes, behind the
+// admin middleware. Otherwise main serves MetricsHandler on a listener of
+// its own.
+var MetricsOnMainServer = false
+
+// MetricsUsername and MetricsPassword require basic auth on /metrics when
+// the password is set.
+var (
+	MetricsUsername string
+	MetricsPassword string
+)
+
+// MetricsHandler serves the metrics of the default registry to Prometheus.
+func MetricsHandler() http.Handler {
+	return metricsAuthMiddleware(metrics.Default.Handler())
+}
+
+func metricsHandlerGet(w http.ResponseWriter, r *http.Request) {
+	MetricsHandler().ServeHTTP(w, r)
+}
+
+func initMetricsRouter(router *routerutils.Router) {
+	if MetricsOnMainServer {
+		router.Get(MetricsPath, metricsHandlerGet, adminMiddleware)
+	}
+}
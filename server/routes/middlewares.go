@@ -1,37 +1,45 @@
 package routes
 
 import (
-	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"runtime/debug"
 
 	"github.com/go-session/session"
 	"server/errs"
+	"server/logging"
+	"server/tlsutil"
 )
 
 func denyAccessToHomeMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		store, err := session.Start(context.Background(), w, r)
+		store, err := session.Start(r.Context(), w, r)
 		if err != nil {
-			errs.InternalServerErrorHandler(w, err, LoginPath)
+			errs.Render(w, r, err, LoginPath)
 			return
 		}
 
-		_, ok := store.Get("user_id")
+		userId, ok := store.Get("user_id")
 
 		if !ok {
 			http.Redirect(w, r, LoginPath, http.StatusSeeOther)
 			return
 		}
 
+		logging.SetUserID(r.Context(), userId.(int))
+
 		next.ServeHTTP(w, r)
 	})
 }
 
 func denyAccessIfAlreadyLoggedInMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		store, err := session.Start(context.Background(), w, r)
+		store, err := session.Start(r.Context(), w, r)
 		if err != nil {
-			errs.InternalServerErrorHandler(w, err, LoginPath)
+			errs.Render(w, r, err, LoginPath)
 			return
 		}
 
@@ -45,3 +53,101 @@ func denyAccessIfAlreadyLoggedInMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// AdminWithoutClientCert opens the admin routes, and the admin details of
+// the health check, to the requests without a verified client certificate.
+// It is only meant for development.
+var AdminWithoutClientCert = false
+
+func isAdminRequest(r *http.Request) bool {
+	return AdminWithoutClientCert || tlsutil.HasVerifiedClientCert(r.TLS)
+}
+
+func adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdminRequest(r) {
+			errs.RenderStatus(w, r, http.StatusForbidden, HomePath)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func metricsAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if MetricsPassword != "" {
+			username, password, ok := r.BasicAuth()
+
+			// both are compared, so the time taken tells nothing
+			validUsername := subtle.ConstantTimeCompare([]byte(username), []byte(MetricsUsername)) == 1
+			validPassword := subtle.ConstantTimeCompare([]byte(password), []byte(MetricsPassword)) == 1
+
+			if !ok || !validUsername || !validPassword {
+				w.Header().Set("WWW-Authenticate", `Basic realm="metrics", charset="UTF-8"`)
+				errs.RenderStatus(w, r, http.StatusUnauthorized, HomePath)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// trackingResponseWriter remembers whether the response has started, so the
+// recovery middleware knows if an error page can still be sent, and with
+// which status.
+type trackingResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	status      int
+}
+
+func (t *trackingResponseWriter) WriteHeader(statusCode int) {
+	if !t.wroteHeader {
+		t.status = statusCode
+	}
+	t.wroteHeader = true
+	t.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (t *trackingResponseWriter) Write(b []byte) (int, error) {
+	if !t.wroteHeader {
+		t.status = http.StatusOK
+	}
+	t.wroteHeader = true
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *trackingResponseWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// recoverMiddleware turns a panic in any handler into the 500 page instead
+// of dropping the connection, logging the stack under the request ID.
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &trackingResponseWriter{ResponseWriter: w}
+
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+
+			if err, ok := p.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(p)
+			}
+
+			slog.ErrorContext(r.Context(), "panic serving request", "method", r.Method, "path", r.URL.Path, "panic", p, "stack", string(debug.Stack()))
+
+			if tw.wroteHeader {
+				return
+			}
+
+			errs.InternalServerErrorHandler(tw, r, fmt.Errorf("panic: %v", p), HomePath)
+		}()
+
+		next.ServeHTTP(tw, r)
+	})
+}
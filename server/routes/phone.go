@@ -0,0 +1,676 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-session/session"
+	"server/db"
+	"server/errs"
+	"server/form"
+	"server/i18n"
+	"server/logging"
+	"server/phone"
+	"server/routerutils"
+	"server/sms"
+	"server/template"
+)
+
+const (
+	verificationCodeLength      = 6
+	verificationCodeTTL         = 10 * time.Minute
+	verificationMaxAttempts     = 5
+	verificationResendInterval  = time.Minute
+	phoneVerificationSessionKey = "phone_verification"
+	phoneVerificationMessage    = "sms.phone_verification"
+)
+
+var (
+	verificationThrottle = &sendThrottle{interval: verificationResendInterval, lastSent: make(map[string]time.Time)}
+	verificationAttempts = &attemptCounter{max: verificationMaxAttempts, attempts: make(map[string]codeAttempts)}
+)
+
+// phoneVerification is the pending verification code of the session. Only
+// the hash of the code is kept.
+type phoneVerification struct {
+	PhoneId   int
+	CodeHash  string
+	ExpiresAt time.Time
+}
+
+// sendThrottle spaces the codes texted to a user, or to a number, by
+// interval. It is kept out of the session so that replacing the phone or
+// starting a new session does not reset it.
+type sendThrottle struct {
+	interval time.Duration
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+}
+
+// attemptCounter counts the guesses at each code on the server. Counted in
+// the session, concurrent requests would all read the same count and
+// overwrite each other.
+type attemptCounter struct {
+	max int
+
+	mu       sync.Mutex
+	attempts map[string]codeAttempts
+}
+
+type codeAttempts struct {
+	count     int
+	expiresAt time.Time
+}
+
+type userPhone struct {
+	PhoneId     int
+	Phone       string
+	CountryCode string
+	IsVerified  bool
+}
+
+func phoneHandlerGet(w http.ResponseWriter, r *http.Request) {
+	_, userId, ok := startPhoneSession(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	connection, err := db.HandlerConnector.GetReadConnection(db.WithConsistencyKey(ctx, phoneConsistencyKey(userId)))
+
+	if err != nil {
+		errs.Render(w, r, errs.Unavailable(err), HomePath)
+		return
+	}
+
+	current, err := getUserPhone(ctx, connection, userId)
+
+	if err != nil {
+		errs.Render(w, r, err, HomePath)
+		return
+	}
+
+	state, err := takeFormState(w, r, PhonePath)
+
+	if err != nil {
+		errs.Render(w, r, err, HomePath)
+		return
+	}
+
+	data := &template.PhonePageData{}
+	data.FillDefault()
+	data.PageFormErrors = state
+	data.Countries = phoneCountries()
+	data.SelectedRegion = phone.DefaultRegion
+
+	if current != nil {
+		data.HasPhone = true
+		data.Phone = current.Phone
+		data.Verified = current.IsVerified
+		data.SelectedRegion = current.CountryCode
+	}
+
+	if value := data.FieldValue(form.CountryFieldName); value != "" {
+		data.SelectedRegion = value
+	}
+
+	_, err = template.Render(w, r, data, template.GetPage("account/phone"))
+
+	if err != nil {
+		errs.Render(w, r, err, HomePath)
+	}
+}
+
+func phoneHandlerPost(w http.ResponseWriter, r *http.Request) {
+	store, userId, ok := startPhoneSession(w, r)
+	if !ok {
+		return
+	}
+
+	phoneFormFields := &form.PhoneFormFields{}
+
+	if err := form.Bind(r, phoneFormFields); err != nil {
+		errs.Render(w, r, errs.BadRequest(err), PhonePath)
+		return
+	}
+
+	state := &template.PageFormErrors{}
+	state.SetValues(map[string]string{
+		form.CountryFieldName: phoneFormFields.Country,
+		form.PhoneFieldName:   phoneFormFields.Phone,
+	})
+
+	valid, err := validatePhoneForm(r, state, phoneFormFields)
+
+	if err != nil {
+		errs.Render(w, r, err, PhonePath)
+		return
+	}
+
+	if !valid {
+		redirectWithFormState(w, r, PhonePath, state)
+		return
+	}
+
+	number, err := phone.Parse(phoneFormFields.Phone, phoneFormFields.Country)
+
+	if err != nil {
+		errs.Render(w, r, errs.BadRequest(err), PhonePath)
+		return
+	}
+
+	ctx := r.Context()
+	connection, err := db.HandlerConnector.GetConnection()
+
+	if err != nil {
+		errs.Render(w, r, errs.Unavailable(err), PhonePath)
+		return
+	}
+
+	inUse, err := isPhoneVerifiedByOtherUser(ctx, connection, number.E164(), userId)
+
+	if err != nil {
+		errs.Render(w, r, err, PhonePath)
+		return
+	}
+
+	if inUse {
+		pushPhoneFieldError(r, state, form.PhoneFieldName, errs.PhoneInUseError)
+		redirectWithFormState(w, r, PhonePath, state)
+		return
+	}
+
+	phoneId, err := replaceUserPhone(ctx, connection, userId, number)
+
+	if err != nil {
+		errs.Render(w, r, err, PhonePath)
+		return
+	}
+
+	db.HandlerConnector.MarkWrite(phoneConsistencyKey(userId))
+	state.SetValues(nil)
+
+	if err = sendPhoneVerificationCode(r, store, state, userId, phoneId, number.E164()); err != nil {
+		errs.Render(w, r, err, PhonePath)
+		return
+	}
+
+	redirectWithFormState(w, r, PhonePath, state)
+}
+
+func phoneVerifyHandlerPost(w http.ResponseWriter, r *http.Request) {
+	store, userId, ok := startPhoneSession(w, r)
+	if !ok {
+		return
+	}
+
+	verificationFormFields := &form.PhoneVerificationFormFields{}
+
+	if err := form.Bind(r, verificationFormFields); err != nil {
+		errs.Render(w, r, errs.BadRequest(err), PhonePath)
+		return
+	}
+
+	state := &template.PageFormErrors{}
+	valid, err := validatePhoneForm(r, state, verificationFormFields)
+
+	if err != nil {
+		errs.Render(w, r, err, PhonePath)
+		return
+	}
+
+	if !valid {
+		redirectWithFormState(w, r, PhonePath, state)
+		return
+	}
+
+	ctx := r.Context()
+	connection, err := db.HandlerConnector.GetConnection()
+
+	if err != nil {
+		errs.Render(w, r, errs.Unavailable(err), PhonePath)
+		return
+	}
+
+	current, err := getUserPhone(ctx, connection, userId)
+
+	if err != nil {
+		errs.Render(w, r, err, PhonePath)
+		return
+	}
+
+	if current == nil || current.IsVerified {
+		http.Redirect(w, r, PhonePath, http.StatusSeeOther)
+		return
+	}
+
+	if message := checkVerificationCode(store, current.PhoneId, verificationFormFields.Code); message != "" {
+		if err = store.Save(); err != nil {
+			errs.Render(w, r, err, PhonePath)
+			return
+		}
+
+		pushPhoneFieldError(r, state, form.VerificationCodeFieldName, message)
+		redirectWithFormState(w, r, PhonePath, state)
+		return
+	}
+
+	if err = markPhoneVerified(ctx, connection, current.PhoneId); err != nil {
+		errs.Render(w, r, err, PhonePath)
+		return
+	}
+
+	db.HandlerConnector.MarkWrite(phoneConsistencyKey(userId))
+
+	store.Delete(phoneVerificationSessionKey)
+	if err = store.Save(); err != nil {
+		errs.Render(w, r, err, PhonePath)
+		return
+	}
+
+	http.Redirect(w, r, PhonePath, http.StatusSeeOther)
+}
+
+func phoneResendHandlerPost(w http.ResponseWriter, r *http.Request) {
+	store, userId, ok := startPhoneSession(w, r)
+	if !ok {
+		return
+	}
+
+	connection, err := db.HandlerConnector.GetConnection()
+
+	if err != nil {
+		errs.Render(w, r, errs.Unavailable(err), PhonePath)
+		return
+	}
+
+	current, err := getUserPhone(r.Context(), connection, userId)
+
+	if err != nil {
+		errs.Render(w, r, err, PhonePath)
+		return
+	}
+
+	state := &template.PageFormErrors{}
+
+	if current != nil && !current.IsVerified {
+		if err = sendPhoneVerificationCode(r, store, state, userId, current.PhoneId, current.Phone); err != nil {
+			errs.Render(w, r, err, PhonePath)
+			return
+		}
+	}
+
+	redirectWithFormState(w, r, PhonePath, state)
+}
+
+func phoneRemoveHandlerPost(w http.ResponseWriter, r *http.Request) {
+	store, userId, ok := startPhoneSession(w, r)
+	if !ok {
+		return
+	}
+
+	connection, err := db.HandlerConnector.GetConnection()
+
+	if err != nil {
+		errs.Render(w, r, errs.Unavailable(err), PhonePath)
+		return
+	}
+
+	if err = removeUserPhone(r.Context(), connection, userId); err != nil {
+		errs.Render(w, r, err, PhonePath)
+		return
+	}
+
+	db.HandlerConnector.MarkWrite(phoneConsistencyKey(userId))
+
+	store.Delete(phoneVerificationSessionKey)
+	if err = store.Save(); err != nil {
+		errs.Render(w, r, err, PhonePath)
+		return
+	}
+
+	http.Redirect(w, r, PhonePath, http.StatusSeeOther)
+}
+
+func startPhoneSession(w http.ResponseWriter, r *http.Request) (session.Store, int, bool) {
+	store, err := session.Start(r.Context(), w, r)
+
+	if err != nil {
+		errs.Render(w, r, err, PhonePath)
+		return nil, 0, false
+	}
+
+	userId, ok := store.Get("user_id")
+
+	if !ok {
+		http.Redirect(w, r, LoginPath, http.StatusSeeOther)
+		return nil, 0, false
+	}
+
+	logging.SetUserID(r.Context(), userId.(int))
+	return store, userId.(int), true
+}
+
+func validatePhoneForm(r *http.Request, state *template.PageFormErrors, fields any) (bool, error) {
+	if err := form.Validate(fields); err != nil {
+		var validationErrors form.ValidationErrors
+
+		if !errors.As(err, &validationErrors) {
+			return false, err
+		}
+
+		state.PushFieldErrors(validationErrors, i18n.FromContext(r.Context()))
+	}
+
+	return !state.HasErrors(), nil
+}
+
+func pushPhoneFieldError(r *http.Request, state *template.PageFormErrors, field, message string, args ...any) {
+	state.PushFieldError(field, i18n.T(i18n.FromContext(r.Context()), message, args...))
+}
+
+// sendPhoneVerificationCode texts a new code for phoneId to the number to,
+// unless a code was sent to the user or to that number less than
+// verificationResendInterval ago. The code replaces the pending one.
+func sendPhoneVerificationCode(r *http.Request, store session.Store, state *template.PageFormErrors, userId, phoneId int, to string) error {
+	ctx := r.Context()
+	locale := i18n.FromContext(ctx)
+
+	if wait := verificationThrottle.reserve("user:"+strconv.Itoa(userId), "phone:"+to); wait > 0 {
+		seconds := int(wait.Seconds()) + 1
+		state.PushFieldError(form.VerificationCodeFieldName, i18n.TN(locale, errs.PhoneResendWaitError, seconds, seconds))
+		return nil
+	}
+
+	code, err := generateVerificationCode()
+
+	if err != nil {
+		return err
+	}
+
+	store.Set(phoneVerificationSessionKey, phoneVerification{
+		PhoneId:   phoneId,
+		CodeHash:  hashVerificationCode(code),
+		ExpiresAt: time.Now().Add(verificationCodeTTL),
+	})
+
+	if err = store.Save(); err != nil {
+		return err
+	}
+
+	minutes := int(verificationCodeTTL.Minutes())
+	message := i18n.TN(locale, phoneVerificationMessage, minutes, code, minutes)
+
+	if err = sms.ActiveSender.Send(ctx, to, message); err != nil {
+		slog.ErrorContext(ctx, "sending the phone verification code failed", logging.Err(err))
+		state.PushFieldError(form.VerificationCodeFieldName, i18n.T(locale, errs.PhoneSendFailedError))
+	}
+
+	return nil
+}
+
+// reserve records a send under every key and returns 0, or returns how long
+// to wait when one of them was used less than interval ago.
+func (t *sendThrottle) reserve(keys ...string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for key, sentAt := range t.lastSent {
+		if now.Sub(sentAt) >= t.interval {
+			delete(t.lastSent, key)
+		}
+	}
+
+	var wait time.Duration
+	for _, key := range keys {
+		if sentAt, ok := t.lastSent[key]; ok && t.interval-now.Sub(sentAt) > wait {
+			wait = t.interval - now.Sub(sentAt)
+		}
+	}
+
+	if wait > 0 {
+		return wait
+	}
+
+	for _, key := range keys {
+		t.lastSent[key] = now
+	}
+
+	return 0
+}
+
+// checkVerificationCode returns the message key of the reason code is
+// rejected, or "" when it is the pending code of phoneId.
+func checkVerificationCode(store session.Store, phoneId int, code string) string {
+	pending, ok := store.Get(phoneVerificationSessionKey)
+	if !ok {
+		return errs.PhoneCodeExpiredError
+	}
+
+	verification := pending.(phoneVerification)
+
+	if verification.PhoneId != phoneId || time.Now().After(verification.ExpiresAt) {
+		return errs.PhoneCodeExpiredError
+	}
+
+	// the phone is part of the key, two phones may be sent the same code
+	key := strconv.Itoa(phoneId) + ":" + verification.CodeHash
+	left, ok := verificationAttempts.take(key, verification.ExpiresAt)
+
+	if !ok {
+		store.Delete(phoneVerificationSessionKey)
+		return errs.PhoneCodeAttemptsError
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashVerificationCode(code)), []byte(verification.CodeHash)) != 1 {
+		if left == 0 {
+			store.Delete(phoneVerificationSessionKey)
+		}
+		return errs.PhoneCodeInvalidError
+	}
+
+	return ""
+}
+
+// take records an attempt at the code of key, valid until expiresAt, and
+// returns how many attempts are left after it. It reports false, without
+// recording anything, when none was left.
+func (c *attemptCounter) take(key string, expiresAt time.Time) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for other, attempts := range c.attempts {
+		if now.After(attempts.expiresAt) {
+			delete(c.attempts, other)
+		}
+	}
+
+	attempts := c.attempts[key]
+	if attempts.count >= c.max {
+		return 0, false
+	}
+
+	attempts.count++
+	attempts.expiresAt = expiresAt
+	c.attempts[key] = attempts
+
+	return c.max - attempts.count, true
+}
+
+func generateVerificationCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < verificationCodeLength; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", verificationCodeLength, n), nil
+}
+
+func hashVerificationCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func getUserPhone(ctx context.Context, connection *db.DB, userId int) (*userPhone, error) {
+	query := "SELECT phones.phone_id, phones.phone, phones.country_code, phones.is_verified " +
+		"FROM users JOIN phones ON users.phone_id = phones.phone_id WHERE users.user_id = ?"
+
+	var current userPhone
+
+	ctx, cancel := db.HandlerConnector.WithQueryTimeout(ctx)
+	defer cancel()
+
+	err := connection.QueryRowContext(ctx, query, userId).Scan(
+		&current.PhoneId, &current.Phone, &current.CountryCode, &current.IsVerified,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &current, nil
+}
+
+func isPhoneVerifiedByOtherUser(ctx context.Context, connection *db.DB, e164 string, userId int) (bool, error) {
+	query := "SELECT COUNT(*) FROM users JOIN phones ON users.phone_id = phones.phone_id " +
+		"WHERE phones.phone = ? AND phones.is_verified = 1 AND users.user_id <> ?"
+
+	var count int
+
+	ctx, cancel := db.HandlerConnector.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := connection.QueryRowContext(ctx, query, e164, userId).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// replaceUserPhone stores number as the unverified phone of the user,
+// deleting the phone it replaces.
+func replaceUserPhone(ctx context.Context, connection *db.DB, userId int, number *phone.Number) (int, error) {
+	var phoneId int
+
+	ctx, cancel := db.HandlerConnector.WithQueryTimeout(ctx)
+	defer cancel()
+
+	err := db.WithTransaction(ctx, connection, func(tx *db.Tx) error {
+		oldPhoneId, err := lockUserPhoneId(ctx, tx, userId)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO phones (phone, country_code, is_verified) VALUES (?, ?, 0)", number.E164(), number.Region,
+		)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		phoneId = int(id)
+
+		if _, err = tx.ExecContext(ctx, "UPDATE users SET phone_id = ? WHERE user_id = ?", phoneId, userId); err != nil {
+			return err
+		}
+
+		return deletePhone(ctx, tx, oldPhoneId)
+	})
+
+	return phoneId, err
+}
+
+func removeUserPhone(ctx context.Context, connection *db.DB, userId int) error {
+	ctx, cancel := db.HandlerConnector.WithQueryTimeout(ctx)
+	defer cancel()
+
+	return db.WithTransaction(ctx, connection, func(tx *db.Tx) error {
+		phoneId, err := lockUserPhoneId(ctx, tx, userId)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, "UPDATE users SET phone_id = NULL WHERE user_id = ?", userId); err != nil {
+			return err
+		}
+
+		return deletePhone(ctx, tx, phoneId)
+	})
+}
+
+func lockUserPhoneId(ctx context.Context, tx *db.Tx, userId int) (sql.NullInt64, error) {
+	var phoneId sql.NullInt64
+
+	err := tx.QueryRowContext(ctx, "SELECT phone_id FROM users WHERE user_id = ? FOR UPDATE", userId).Scan(&phoneId)
+	return phoneId, err
+}
+
+func deletePhone(ctx context.Context, tx *db.Tx, phoneId sql.NullInt64) error {
+	if !phoneId.Valid {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, "DELETE FROM phones WHERE phone_id = ?", phoneId.Int64)
+	return err
+}
+
+func markPhoneVerified(ctx context.Context, connection *db.DB, phoneId int) error {
+	ctx, cancel := db.HandlerConnector.WithQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := connection.ExecContext(ctx, "UPDATE phones SET is_verified = 1 WHERE phone_id = ?", phoneId)
+	return err
+}
+
+func phoneCountries() []template.PhoneCountry {
+	regions := phone.Regions()
+	countries := make([]template.PhoneCountry, 0, len(regions))
+
+	for _, region := range regions {
+		country, _ := phone.Lookup(region)
+		countries = append(countries, template.PhoneCountry{Region: region, CallingCode: country.CallingCode})
+	}
+
+	return countries
+}
+
+func initPhoneRouter(router *routerutils.Router) {
+	router.Get(PhonePath, phoneHandlerGet, denyAccessToHomeMiddleware)
+	router.Post(PhonePath, phoneHandlerPost, nil)
+	router.Post(PhoneVerifyPath, phoneVerifyHandlerPost, nil)
+	router.Post(PhoneResendPath, phoneResendHandlerPost, nil)
+	router.Post(PhoneRemovePath, phoneRemoveHandlerPost, nil)
+}
+
+func phoneConsistencyKey(userId int) string {
+	return "phone:" + strconv.Itoa(userId)
+}
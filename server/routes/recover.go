@@ -1,64 +1,103 @@
 package routes
 
 import (
-	"database/sql"
+	"context"
 	"errors"
-	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"server/db"
 	"server/errs"
 	"server/form"
+	"server/i18n"
+	"server/phone"
 	"server/routerutils"
 	"server/template"
 	"server/utils"
 )
 
-var templateRecoveryData template.RecoveryPageData
-
 func recoverHandlerGet(w http.ResponseWriter, r *http.Request) {
-	_, err := template.Render(w, nil, template.GetView("recover"))
+	state, err := takeFormState(w, r, RecoverPath)
+
+	if err != nil {
+		errs.Render(w, r, err, LoginPath)
+		return
+	}
+
+	data := &template.RecoveryPageData{}
+	data.FillDefault()
+	data.PageFormErrors = state
+
+	_, err = template.Render(w, r, data, template.GetPage("recover"))
 
 	if err != nil {
-		errs.InternalServerErrorHandler(w, err, RecoverPath)
+		errs.Render(w, r, err, RecoverPath)
 	}
 }
 
 func recoverHandlerPost(w http.ResponseWriter, r *http.Request) {
-	connection, err := db.HandlerConnector.GetConnection()
+	state := &template.PageFormErrors{}
+	recoveryFormFields, ok, err := getRecoveryFormFields(r, state)
 
 	if err != nil {
-		log.Fatal(err)
+		errs.Render(w, r, err, RecoverPath)
+		return
 	}
 
-	recoveryFormFields, err := getRecoveryFormFields(r)
+	if !ok {
+		redirectWithFormState(w, r, RecoverPath, state)
+		return
+	}
+
+	connection, err := db.HandlerConnector.GetReadConnection(r.Context())
 
 	if err != nil {
-		errs.InternalServerErrorHandler(w, err, LoginPath)
+		errs.Render(w, r, errs.Unavailable(err), RecoverPath)
 		return
 	}
 
-	user, err := getUserByRecoveryMethod(connection, recoveryFormFields.Value)
+	user, err := getUserByRecoveryMethod(r.Context(), connection, recoveryFormFields.Value)
 
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			templateRecoveryData.EnableErrorView(true)
-			templateRecoveryData.PushError("Error")
+		if errs.FromError(err).Code != errs.CodeNotFound {
+			errs.Render(w, r, err, RecoverPath)
+			return
 		}
+
+		recoveryRequestsTotal.With(recoveryMethodLabel(recoveryFormFields.MethodType), "not_found").Inc()
+		state.PushError(i18n.T(i18n.FromContext(r.Context()), errs.NoAccountForRecoveryError))
+		redirectWithFormState(w, r, RecoverPath, state)
+		return
 	}
 
-	fmt.Println(user)
+	recoveryRequestsTotal.With(recoveryMethodLabel(recoveryFormFields.MethodType), "found").Inc()
+	slog.InfoContext(r.Context(), "account recovery requested", "user_id", user.UserId)
+
+	data := &template.RecoveryPageData{}
+	data.FillDefault()
+
+	_, err = template.Render(w, r, data, template.GetPage("recover_sent"))
 
+	if err != nil {
+		errs.Render(w, r, err, RecoverPath)
+	}
 }
 
-func getUserByRecoveryMethod(connection *sql.DB, recoveryMethodValue string) (*form.UserWithPhone, error) {
-	query := "SELECT * FROM users.*, phone LEFT JOIN phones ON users.phone_id = phones.phone_id WHERE users.email = ? OR phones.phone = ?"
+// getUserByRecoveryMethod matches recoveryMethodValue against the email and
+// the verified phone of the users. Phones are stored in E.164 form, so a
+// phone value must have been normalized by getRecoveryFormFields.
+func getUserByRecoveryMethod(ctx context.Context, connection *db.DB, recoveryMethodValue string) (*form.UserWithPhone, error) {
+	query := "SELECT users.user_id, users.username, users.email, users.password, users.login_attempts, users.is_locked, " +
+		"COALESCE(users.phone_id, 0), COALESCE(phones.phone, ''), COALESCE(phones.country_code, '') " +
+		"FROM users LEFT JOIN phones ON users.phone_id = phones.phone_id WHERE users.email = ? OR (phones.phone = ? AND phones.is_verified = 1)"
 
 	var user form.UserWithPhone
 
-	if err := connection.QueryRow(query, recoveryMethodValue, recoveryMethodValue).Scan(
-		&user.UserId, &user.Username, &user.Email, &user.Password, &user.LoginAttempts, &user.IsLocked, &user.PhoneId, &user.Phone,
+	ctx, cancel := db.HandlerConnector.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := connection.QueryRowContext(ctx, query, recoveryMethodValue, recoveryMethodValue).Scan(
+		&user.UserId, &user.Username, &user.Email, &user.Password, &user.LoginAttempts, &user.IsLocked, &user.PhoneId, &user.Phone, &user.CountryCode,
 	); err != nil {
 		return nil, err
 	}
@@ -71,29 +110,49 @@ func predictTypeOfRecoveryMethod(recoveryMethodValue string) form.RecoveryMethod
 
 	if utils.IsValidEmail(recoveryMethodValue) {
 		recoveryMethodType.SetAsEmail()
-	} else if utils.IsValidPhoneNumber(recoveryMethodValue) {
+	} else if phone.IsValid(recoveryMethodValue, phone.DefaultRegion) {
 		recoveryMethodType.SetAsPhone()
 	}
 
 	return recoveryMethodType
 }
 
-func getRecoveryFormFields(r *http.Request) (*form.RecoveryFromFields, error) {
-	if err := r.ParseForm(); err != nil {
-		return nil, err
+func getRecoveryFormFields(r *http.Request, state *template.PageFormErrors) (*form.RecoveryFromFields, bool, error) {
+	recoveryFormFields := &form.RecoveryFromFields{}
+
+	if err := form.Bind(r, recoveryFormFields); err != nil {
+		return nil, false, errs.BadRequest(err)
+	}
+
+	state.SetValues(map[string]string{
+		form.RecoveryMethodFieldName: recoveryFormFields.Value,
+	})
+
+	if err := form.Validate(recoveryFormFields); err != nil {
+		var validationErrors form.ValidationErrors
+
+		if !errors.As(err, &validationErrors) {
+			return nil, false, err
+		}
+
+		state.PushFieldErrors(validationErrors, i18n.FromContext(r.Context()))
+		return nil, false, nil
 	}
 
-	recoveryMethodValue := r.Form.Get(form.RecoveryMethodFieldName)
-	recoveryMethodType := predictTypeOfRecoveryMethod(recoveryMethodValue)
+	recoveryFormFields.MethodType = predictTypeOfRecoveryMethod(recoveryFormFields.Value)
+
+	if recoveryFormFields.MethodType == form.RecoveryMethodPhone {
+		normalized, err := phone.Normalize(recoveryFormFields.Value, phone.DefaultRegion)
+		if err != nil {
+			return nil, false, err
+		}
+		recoveryFormFields.Value = normalized
+	}
 
-	return &form.RecoveryFromFields{
-		Value:      recoveryMethodValue,
-		MethodType: recoveryMethodType,
-	}, nil
+	return recoveryFormFields, true, nil
 }
 
 func initRecoverRouter(router *routerutils.Router) {
-	templateRecoveryData.FillDefault()
 	router.Get(RecoverPath, recoverHandlerGet, denyAccessIfAlreadyLoggedInMiddleware)
 	router.Post(RecoverPath, recoverHandlerPost, nil)
 }
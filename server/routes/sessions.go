@@ -0,0 +1,140 @@
+package routes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-session/session"
+	"server/metrics"
+)
+
+// sessionTracker wraps the session store to count the sessions of logged
+// in users, those saved with a user_id, until they expire or are deleted.
+// Like the memory store, it only extends a session when it is used again.
+type sessionTracker struct {
+	session.ManagerStore
+
+	mu       sync.Mutex
+	expiries map[string]time.Time
+}
+
+type trackedSession struct {
+	session.Store
+	tracker *sessionTracker
+	expired int64
+}
+
+// TrackSessions reports the logged in sessions of store in the
+// sessions_active metric.
+func TrackSessions(store session.ManagerStore) session.ManagerStore {
+	tracker := &sessionTracker{ManagerStore: store, expiries: make(map[string]time.Time)}
+
+	metrics.NewGaugeFunc(
+		"sessions_active",
+		"Number of sessions of logged in users that have not expired.",
+		func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(tracker.count())}}
+		},
+	)
+
+	return tracker
+}
+
+func (t *sessionTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for sid, expiry := range t.expiries {
+		if !expiry.After(now) {
+			delete(t.expiries, sid)
+		}
+	}
+
+	return len(t.expiries)
+}
+
+func (t *sessionTracker) extend(sid string, expired int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.expiries[sid]; ok {
+		t.expiries[sid] = time.Now().Add(time.Duration(expired) * time.Second)
+	}
+}
+
+func (t *sessionTracker) saved(sid string, expired int64, loggedIn bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !loggedIn {
+		delete(t.expiries, sid)
+		return
+	}
+
+	if _, ok := t.expiries[sid]; !ok {
+		t.expiries[sid] = time.Now().Add(time.Duration(expired) * time.Second)
+	}
+}
+
+func (t *sessionTracker) forget(sid string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.expiries, sid)
+}
+
+func (t *sessionTracker) wrap(store session.Store, err error, expired int64) (session.Store, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &trackedSession{Store: store, tracker: t, expired: expired}, nil
+}
+
+func (t *sessionTracker) Create(ctx context.Context, sid string, expired int64) (session.Store, error) {
+	store, err := t.ManagerStore.Create(ctx, sid, expired)
+	return t.wrap(store, err, expired)
+}
+
+func (t *sessionTracker) Update(ctx context.Context, sid string, expired int64) (session.Store, error) {
+	store, err := t.ManagerStore.Update(ctx, sid, expired)
+	if err == nil {
+		t.extend(sid, expired)
+	}
+	return t.wrap(store, err, expired)
+}
+
+func (t *sessionTracker) Delete(ctx context.Context, sid string) error {
+	t.forget(sid)
+	return t.ManagerStore.Delete(ctx, sid)
+}
+
+func (t *sessionTracker) Refresh(ctx context.Context, oldsid, sid string, expired int64) (session.Store, error) {
+	store, err := t.ManagerStore.Refresh(ctx, oldsid, sid, expired)
+	if err == nil {
+		t.forget(oldsid)
+		_, loggedIn := store.Get("user_id")
+		t.saved(sid, expired, loggedIn)
+	}
+	return t.wrap(store, err, expired)
+}
+
+func (s *trackedSession) Save() error {
+	if err := s.Store.Save(); err != nil {
+		return err
+	}
+
+	_, loggedIn := s.Store.Get("user_id")
+	s.tracker.saved(s.SessionID(), s.expired, loggedIn)
+	return nil
+}
+
+func (s *trackedSession) Flush() error {
+	if err := s.Store.Flush(); err != nil {
+		return err
+	}
+
+	s.tracker.forget(s.SessionID())
+	return nil
+}
@@ -2,28 +2,24 @@ package routes
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
 
 	"github.com/go-session/session"
-	"golang.org/x/crypto/bcrypt"
 	"server/db"
 	"server/errs"
 	"server/form"
+	"server/i18n"
+	"server/password"
 	"server/routerutils"
 	"server/template"
-	"server/utils"
 )
 
-var templateSignupData = &template.SignupPageData{}
-
 func signupHandlerGet(w http.ResponseWriter, r *http.Request) {
-	store, err := session.Start(context.Background(), w, r)
+	store, err := session.Start(r.Context(), w, r)
 
 	if err != nil {
-		errs.InternalServerErrorHandler(w, err, SignupPath)
+		errs.Render(w, r, err, SignupPath)
 		return
 	}
 
@@ -34,54 +30,69 @@ func signupHandlerGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = template.Render(w, templateSignupData, template.GetView("index"), template.GetLayout("signup"))
+	state, err := takeFormState(w, r, SignupPath)
 
 	if err != nil {
-		errs.InternalServerErrorHandler(w, err, SignupPath)
+		errs.Render(w, r, err, SignupPath)
+		return
 	}
 
-	templateSignupData.EnableErrorView(false)
-	templateSignupData.ClearErrors()
+	data := &template.SignupPageData{}
+	data.FillDefault()
+	data.PageFormErrors = state
+
+	_, err = template.Render(w, r, data, template.GetPage("signup"))
+
+	if err != nil {
+		errs.Render(w, r, err, SignupPath)
+	}
 }
 
 func signupHandlerPost(w http.ResponseWriter, r *http.Request) {
 	connection, err := db.HandlerConnector.GetConnection()
 
 	if err != nil {
-		log.Fatal(err)
+		errs.Render(w, r, errs.Unavailable(err), SignupPath)
+		return
 	}
 
-	signupFormFields, err := validateSignupFormFields(r, connection)
+	state := &template.PageFormErrors{}
+	signupFormFields, err := validateSignupFormFields(r, state, connection)
 
 	if err != nil {
-		errs.InternalServerErrorHandler(w, err, SignupPath)
+		errs.Render(w, r, err, SignupPath)
 		return
 	}
 
-	if templateSignupData.HasErrors() {
-		templateSignupData.EnableErrorView(true)
-		http.Redirect(w, r, SignupPath, http.StatusSeeOther)
+	if state.HasErrors() {
+		redirectWithFormState(w, r, SignupPath, state)
 		return
 	}
 
-	if err = insertNewUser(connection, signupFormFields); err != nil {
-		errs.InternalServerErrorHandler(w, err, SignupPath)
+	if err = insertNewUser(r.Context(), connection, signupFormFields); err != nil {
+		errs.Render(w, r, err, SignupPath)
 		return
 	}
 
+	db.HandlerConnector.MarkWrite(userConsistencyKey(signupFormFields.Email))
+	signupsTotal.With().Inc()
+
 	http.Redirect(w, r, LoginPath, http.StatusSeeOther)
 }
 
-func insertNewUser(connection *sql.DB, signupFormFields *form.SignupFormFields) error {
+func insertNewUser(ctx context.Context, connection *db.DB, signupFormFields *form.SignupFormFields) error {
 	query := "INSERT INTO users(username, email, password) VALUES (?, ?, ?)"
 
-	hashedPassword, err := generateHashedPassword([]byte(signupFormFields.Password))
+	hashedPassword, err := password.ActiveHashing.Hash(signupFormFields.Password)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = connection.Exec(query, signupFormFields.Username, signupFormFields.Email, hashedPassword)
+	ctx, cancel := db.HandlerConnector.WithQueryTimeout(ctx)
+	defer cancel()
+
+	_, err = connection.ExecContext(ctx, query, signupFormFields.Username, signupFormFields.Email, hashedPassword)
 
 	if err != nil {
 		return err
@@ -90,80 +101,54 @@ func insertNewUser(connection *sql.DB, signupFormFields *form.SignupFormFields)
 	return nil
 }
 
-func generateHashedPassword(password []byte) ([]byte, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword(password, bcrypt.DefaultCost)
+func validateSignupFormFields(r *http.Request, state *template.PageFormErrors, connection *db.DB) (*form.SignupFormFields, error) {
+	signupFormFields := &form.SignupFormFields{}
 
-	if err != nil {
-		return nil, err
+	if err := form.Bind(r, signupFormFields); err != nil {
+		return nil, errs.BadRequest(err)
 	}
 
-	return hashedPassword, nil
-}
+	state.SetValues(map[string]string{
+		form.UsernameFieldName: signupFormFields.Username,
+		form.EmailFieldName:    signupFormFields.Email,
+	})
 
-func getSignupFormFields(r *http.Request) (*form.SignupFormFields, error) {
-	if err := r.ParseForm(); err != nil {
-		return nil, err
-	}
+	if err := form.Validate(signupFormFields); err != nil {
+		var validationErrors form.ValidationErrors
 
-	return &form.SignupFormFields{
-		Username:        r.Form.Get(form.UsernameFieldName),
-		Email:           r.Form.Get(form.EmailFieldName),
-		Password:        r.Form.Get(form.PasswordFieldName),
-		ConfirmPassword: r.Form.Get(form.ConfirmPasswordFieldName),
-	}, nil
-}
-
-func validateSignupFormFields(r *http.Request, connection *sql.DB) (*form.SignupFormFields, error) {
-	signupFormFields, err := getSignupFormFields(r)
+		if !errors.As(err, &validationErrors) {
+			return nil, err
+		}
 
-	if err != nil {
-		return nil, err
+		state.PushFieldErrors(validationErrors, i18n.FromContext(r.Context()))
 	}
 
-	if utils.IsEmptyStr(signupFormFields.Username) {
-		templateSignupData.PushError(fmt.Sprintf(errs.InvalidUsernameError, signupFormFields.Username))
-	}
-
-	if len(signupFormFields.Password) < form.MinNumberCharsPassword {
-		templateSignupData.PushError(fmt.Sprintf(
-			errs.ShortPasswordError,
-			form.MinNumberCharsPassword,
-			len(signupFormFields.Password),
-		))
-	}
-
-	if signupFormFields.Password != signupFormFields.ConfirmPassword {
-		templateSignupData.PushError(errs.PasswordsNotMatchError)
-	}
-
-	if !utils.IsValidEmail(signupFormFields.Email) {
-		templateSignupData.PushError(fmt.Sprintf(errs.InvalidEmailError, signupFormFields.Email))
-	}
-
-	if err := checkDuplicateEmail(connection, signupFormFields.Email); err != nil {
+	if err := checkDuplicateEmail(r.Context(), state, connection, signupFormFields.Email); err != nil {
 		return nil, err
 	}
 
 	return signupFormFields, nil
 }
 
-func checkDuplicateEmail(connection *sql.DB, email string) error {
+func checkDuplicateEmail(ctx context.Context, state *template.PageFormErrors, connection *db.DB, email string) error {
 	var countOfEmail int
 	query := "SELECT COUNT(*) FROM users WHERE email=?"
 
-	if err := connection.QueryRow(query, email).Scan(&countOfEmail); err != nil {
+	ctx, cancel := db.HandlerConnector.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := connection.QueryRowContext(ctx, query, email).Scan(&countOfEmail); err != nil {
 		return err
 	}
 
 	if countOfEmail > 0 {
-		templateSignupData.PushError(fmt.Sprintf(errs.DuplicateEmailError, email))
+		state.PushFieldError(form.EmailFieldName, i18n.T(i18n.FromContext(ctx), errs.DuplicateEmailError, email))
 	}
 
 	return nil
 }
 
 func initSignupRouter(router *routerutils.Router) {
-	templateSignupData.FillDefault()
 	router.Get(SignupPath, signupHandlerGet, denyAccessIfAlreadyLoggedInMiddleware)
 	router.Post(SignupPath, signupHandlerPost, nil)
 }
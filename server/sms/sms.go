@@ -0,0 +1,71 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"server/errs"
+)
+
+// Sender delivers a text message to a phone number in E.164 form.
+type Sender interface {
+	Send(ctx context.Context, to, message string) error
+}
+
+// LogSender writes the messages to the log instead of sending them. It is
+// meant for development only, as the log then holds verification codes.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, to, message string) error {
+	slog.InfoContext(ctx, "sms sent", "to", to, "message", message)
+	return nil
+}
+
+// WebhookSender posts {"to": ..., "message": ...} as JSON to URL, with
+// Token as a bearer token when set, for a gateway to deliver.
+type WebhookSender struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+func NewWebhookSender(url, token string) *WebhookSender {
+	return &WebhookSender{URL: url, Token: token, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *WebhookSender) Send(ctx context.Context, to, message string) error {
+	body, err := json.Marshal(map[string]string{"to": to, "message": message})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%s: %s", errs.SMSDeliveryFailedError, response.Status)
+	}
+
+	return nil
+}
+
+// ActiveSender sends every message of the application.
+var ActiveSender Sender = LogSender{}
@@ -0,0 +1,258 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	devModePollInterval   = time.Second
+	templateCacheKeySplit = "|"
+)
+
+type templateCache struct {
+	templates map[string]*template.Template
+	mu        sync.RWMutex
+}
+
+var cache = &templateCache{templates: make(map[string]*template.Template)}
+
+func cacheKey(layout, page string) string {
+	return layout + templateCacheKeySplit + page
+}
+
+func templateName(path string) string {
+	return filepath.Base(path)
+}
+
+// files holds the views directory tree. It defaults to the working
+// directory and is replaced by SetFileSystem with the embedded assets.
+var files fs.FS = os.DirFS(".")
+
+func SetFileSystem(fsys fs.FS) {
+	files = fsys
+}
+
+// parse builds the template set for page: the layout it extends, every
+// partial, and the page itself, in that order so the page's blocks win.
+func parse(layout, page string) (*template.Template, error) {
+	partials, err := fs.Glob(files, partialsDirectoryName+"*"+layoutFileExtensionType)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := append([]string{layout}, partials...)
+	patterns = append(patterns, page)
+
+	tmpl := template.New(templateName(layout)).Funcs(funcMap)
+	return tmpl.ParseFS(files, patterns...)
+}
+
+func (c *templateCache) get(layout, page string) (*template.Template, error) {
+	key := cacheKey(layout, page)
+
+	c.mu.RLock()
+	tmpl, ok := c.templates[key]
+	c.mu.RUnlock()
+
+	if ok {
+		return tmpl, nil
+	}
+
+	tmpl, err := parse(layout, page)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.templates[key] = tmpl
+	c.mu.Unlock()
+
+	return tmpl, nil
+}
+
+func (c *templateCache) replace(templates map[string]*template.Template) {
+	c.mu.Lock()
+	c.templates = templates
+	c.mu.Unlock()
+}
+
+// listPages returns every page in the pages directory and its subdirectories.
+func listPages() ([]string, error) {
+	var pages []string
+
+	err := fs.WalkDir(files, strings.TrimSuffix(pagesDirectoryName, "/"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() && filepath.Ext(path) == layoutFileExtensionType {
+			pages = append(pages, path)
+		}
+		return nil
+	})
+
+	return pages, err
+}
+
+// parseAll parses every page on top of the default layout.
+func parseAll() (map[string]*template.Template, error) {
+	pages, err := listPages()
+	if err != nil {
+		return nil, err
+	}
+
+	layout := GetLayout(defaultLayoutName)
+	templates := make(map[string]*template.Template, len(pages))
+	var parseErrors []error
+
+	for _, page := range pages {
+		tmpl, err := parse(layout, page)
+		if err != nil {
+			parseErrors = append(parseErrors, fmt.Errorf("%s: %w", page, err))
+			continue
+		}
+		templates[cacheKey(layout, page)] = tmpl
+	}
+
+	if len(parseErrors) > 0 {
+		return nil, errors.Join(parseErrors...)
+	}
+
+	return templates, nil
+}
+
+// watcher is the views watcher started by Load in dev mode, stopped by
+// StopWatching.
+var watcher struct {
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Load parses every page into the cache. It must succeed before
+// the server starts accepting requests. When devMode is enabled, the views
+// directory is watched and the cache is rebuilt whenever a file changes,
+// which needs a file system on disk: embedded files have no modification
+// time. Loading again does not start a second watcher.
+func Load(devMode bool) error {
+	templates, err := parseAll()
+	if err != nil {
+		return err
+	}
+
+	cache.replace(templates)
+
+	if devMode {
+		startWatching()
+	}
+
+	return nil
+}
+
+func startWatching() {
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+
+	if watcher.stop != nil {
+		return
+	}
+
+	watcher.stop, watcher.done = make(chan struct{}), make(chan struct{})
+	go watchViews(watcher.stop, watcher.done)
+}
+
+// StopWatching stops the views watcher, if any, and waits for it to return
+// until ctx is done.
+func StopWatching(ctx context.Context) error {
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+
+	if watcher.stop == nil {
+		return nil
+	}
+
+	close(watcher.stop)
+	done := watcher.done
+	watcher.stop, watcher.done = nil, nil
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func viewsModTime() (time.Time, error) {
+	var latest time.Time
+
+	err := fs.WalkDir(files, strings.TrimSuffix(viewsDirectoryName, "/"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+
+	return latest, err
+}
+
+func watchViews(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	lastModTime, err := viewsModTime()
+	if err != nil {
+		slog.Error("watching views failed", "error", err)
+	}
+
+	ticker := time.NewTicker(devModePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		modTime, err := viewsModTime()
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				slog.Error("watching views failed", "error", err)
+			}
+			continue
+		}
+
+		if !modTime.After(lastModTime) {
+			continue
+		}
+		lastModTime = modTime
+
+		templates, err := parseAll()
+		if err != nil {
+			slog.Error("templates not reloaded", "error", err)
+			continue
+		}
+
+		cache.replace(templates)
+		slog.Info("templates reloaded")
+	}
+}
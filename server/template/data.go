@@ -1,10 +1,20 @@
 package template
 
-import "server/utils"
+import (
+	"html/template"
 
+	"server/form"
+	"server/utils"
+)
+
+// PageFormErrors keeps the outcome of the last form submission: general
+// errors shown at the top of the form, errors keyed by field name shown next
+// to their input, and the submitted values used to re-fill the inputs.
 type PageFormErrors struct {
-	ShowErrors bool
-	Errors     []string
+	ShowErrors  bool
+	Errors      []template.HTML
+	FieldErrors map[string]string
+	Values      map[string]string
 }
 
 func (f *PageFormErrors) EnableErrorView(state bool) {
@@ -12,15 +22,59 @@ func (f *PageFormErrors) EnableErrorView(state bool) {
 }
 
 func (f *PageFormErrors) PushError(errMessage string) {
-	utils.Append[string](&f.Errors, errMessage)
+	utils.Append[template.HTML](&f.Errors, template.HTML(template.HTMLEscapeString(errMessage)))
+}
+
+// PushHTMLError adds a message containing trusted markup, such as a link,
+// that is rendered as-is by the error list component.
+func (f *PageFormErrors) PushHTMLError(errMessage template.HTML) {
+	utils.Append[template.HTML](&f.Errors, errMessage)
+}
+
+// PushFieldError sets the message shown next to the input named field. Only
+// the first error of each field is kept.
+func (f *PageFormErrors) PushFieldError(field, errMessage string) {
+	if f.FieldErrors == nil {
+		f.FieldErrors = make(map[string]string)
+	}
+
+	if _, ok := f.FieldErrors[field]; !ok {
+		f.FieldErrors[field] = errMessage
+	}
+}
+
+// PushFieldErrors adds the translated message of every failed field.
+func (f *PageFormErrors) PushFieldErrors(validationErrors form.ValidationErrors, locale string) {
+	for _, fieldErr := range validationErrors {
+		f.PushFieldError(fieldErr.Field, fieldErr.Translate(locale))
+	}
+}
+
+// SetValues stores the submitted values so the inputs keep them after a
+// failed submission. Secrets such as passwords must not be passed.
+func (f *PageFormErrors) SetValues(values map[string]string) {
+	f.Values = values
 }
 
 func (f *PageFormErrors) ClearErrors() {
-	f.Errors = []string{}
+	f.Errors = []template.HTML{}
+	f.FieldErrors = map[string]string{}
+	f.Values = map[string]string{}
 }
 
 func (f *PageFormErrors) HasErrors() bool {
-	return len(f.Errors) > 0
+	return len(f.Errors) > 0 || len(f.FieldErrors) > 0
+}
+
+func (f *PageFormErrors) FieldError(field string) string {
+	if !f.ShowErrors {
+		return ""
+	}
+	return f.FieldErrors[field]
+}
+
+func (f *PageFormErrors) FieldValue(field string) string {
+	return f.Values[field]
 }
 
 type FormPageData struct {
@@ -34,7 +88,7 @@ func (f *FormPageData) SetTitle(title string) {
 
 func (f *FormPageData) FillDefault() {
 	f.ShowErrors = false
-	f.Errors = []string{}
+	f.ClearErrors()
 }
 
 type LoginPageData struct {
@@ -42,7 +96,7 @@ type LoginPageData struct {
 }
 
 func (l *LoginPageData) FillDefault() {
-	l.Title = "Log In"
+	l.Title = "page.login.title"
 }
 
 type SignupPageData struct {
@@ -50,7 +104,7 @@ type SignupPageData struct {
 }
 
 func (s *SignupPageData) FillDefault() {
-	s.Title = "Sign Up"
+	s.Title = "page.signup.title"
 }
 
 type RecoveryPageData struct {
@@ -58,10 +112,38 @@ type RecoveryPageData struct {
 }
 
 func (r *RecoveryPageData) FillDefault() {
-	r.Title = "Recovery"
+	r.Title = "page.recover.title"
+}
+
+type PhoneCountry struct {
+	Region      string
+	CallingCode string
+}
+
+// PhonePageData is the account phone page. Phone is in E.164 form.
+type PhonePageData struct {
+	FormPageData
+	HasPhone       bool
+	Phone          string
+	Verified       bool
+	SelectedRegion string
+	Countries      []PhoneCountry
+}
+
+func (p *PhonePageData) FillDefault() {
+	p.Title = "page.phone.title"
 }
 
 type InternalServerErrorPageData struct {
 	Title     string
 	BackRoute string
+	RequestID string
+}
+
+type ErrorPageData struct {
+	Title     string
+	Status    int
+	Message   string
+	BackRoute string
+	RequestID string
 }
@@ -0,0 +1,40 @@
+package template
+
+// formState is implemented by page data embedding PageFormErrors.
+type formState interface {
+	FieldError(field string) string
+	FieldValue(field string) string
+}
+
+// FieldView is what the "input" component needs to render a form field
+// with its error message, sticky value and accessibility attributes.
+type FieldView struct {
+	Name    string
+	Type    string
+	ID      string
+	Value   string
+	Error   string
+	ErrorID string
+}
+
+func (f FieldView) Invalid() bool {
+	return f.Error != ""
+}
+
+// field builds the FieldView of the input named name from the page data.
+// Password inputs never get their value back.
+func field(data interface{}, name, inputType, id string) FieldView {
+	view := FieldView{Name: name, Type: inputType, ID: id, ErrorID: id + "-error"}
+
+	state, ok := data.(formState)
+	if !ok {
+		return view
+	}
+
+	view.Error = state.FieldError(name)
+	if inputType != "password" {
+		view.Value = state.FieldValue(name)
+	}
+
+	return view
+}
@@ -1,41 +1,104 @@
 package template
 
 import (
+	"bytes"
 	"html/template"
 	"net/http"
-	"path/filepath"
+
+	"server/i18n"
 )
 
 const (
 	viewsDirectoryName      = "views/"
 	layoutsDirectoryName    = viewsDirectoryName + "layouts/"
+	pagesDirectoryName      = viewsDirectoryName + "pages/"
+	partialsDirectoryName   = viewsDirectoryName + "partials/"
 	layoutFileExtensionType = ".html"
+	defaultLayoutName       = "base"
 )
 
+// HTML marks a string as trusted markup that must not be escaped.
+type HTML = template.HTML
+
 var funcMap = template.FuncMap{
 	"safeHTML": func(s string) template.HTML {
 		return template.HTML(s)
 	},
+	"field": field,
+	// placeholders replaced with the request's locale by localeFuncMap
+	"t":      func(key string, args ...any) string { return key },
+	"tn":     func(key string, count int, args ...any) string { return key },
+	"locale": func() string { return i18n.DefaultLocale },
+}
+
+func localeFuncMap(locale string) template.FuncMap {
+	return template.FuncMap{
+		"t": func(key string, args ...any) string {
+			return i18n.T(locale, key, args...)
+		},
+		"tn": func(key string, count int, args ...any) string {
+			return i18n.TN(locale, key, count, args...)
+		},
+		"locale": func() string {
+			return locale
+		},
+	}
+}
+
+// Render executes page inside the default base layout. The page overrides the
+// layout's "title", "head", "content" and "scripts" blocks and can use any
+// component defined in the partials directory.
+func Render(w http.ResponseWriter, r *http.Request, data interface{}, page string) (*template.Template, error) {
+	return RenderWithLayout(w, r, data, GetLayout(defaultLayoutName), page)
+}
+
+// RenderStatus is Render answering with status. The status is only written
+// once the page has rendered, so a page that fails can still be answered
+// with another response.
+func RenderStatus(w http.ResponseWriter, r *http.Request, status int, data interface{}, page string) (*template.Template, error) {
+	return renderWithLayout(w, r, status, data, GetLayout(defaultLayoutName), page)
+}
+
+func RenderWithLayout(w http.ResponseWriter, r *http.Request, data interface{}, layout, page string) (*template.Template, error) {
+	return renderWithLayout(w, r, 0, data, layout, page)
 }
 
-func Render(w http.ResponseWriter, data interface{}, path ...string) (*template.Template, error) {
-	tmpl := template.New(filepath.Base(path[0])).Funcs(funcMap)
-	tmpl, err := tmpl.ParseFiles(path...)
+func renderWithLayout(w http.ResponseWriter, r *http.Request, status int, data interface{}, layout, page string) (*template.Template, error) {
+	cached, err := cache.get(layout, page)
 	if err != nil {
 		return nil, err
 	}
 
-	err = tmpl.ExecuteTemplate(w, filepath.Base(path[0]), data)
+	// cached templates are shared between requests and never executed
+	// directly, so each render binds its own locale to a clone.
+	tmpl, err := cached.Clone()
 	if err != nil {
 		return nil, err
 	}
+	tmpl.Funcs(localeFuncMap(i18n.FromContext(r.Context())))
+
+	var buf bytes.Buffer
+
+	err = tmpl.ExecuteTemplate(&buf, templateName(layout), data)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != 0 {
+		w.WriteHeader(status)
+	}
+
+	if _, err = buf.WriteTo(w); err != nil {
+		return nil, err
+	}
 
 	return tmpl, nil
 }
+
 func GetLayout(filename string) string {
 	return layoutsDirectoryName + filename + layoutFileExtensionType
 }
 
-func GetView(filename string) string {
-	return viewsDirectoryName + filename + layoutFileExtensionType
+func GetPage(filename string) string {
+	return pagesDirectoryName + filename + layoutFileExtensionType
 }
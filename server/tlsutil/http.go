@@ -0,0 +1,91 @@
+package tlsutil
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedirectHandler sends every request to the same URL over HTTPS on
+// httpsPort. GET and HEAD are redirected permanently with 301, other
+// methods with 308 so that browsers repeat them with their body.
+func RedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.Trim(host, "[]")
+		}
+
+		if host == "" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+
+		http.Redirect(w, r, target, status)
+	})
+}
+
+type HSTSOptions struct {
+	MaxAge            time.Duration
+	IncludeSubdomains bool
+	Preload           bool
+}
+
+func (o HSTSOptions) header() string {
+	value := "max-age=" + strconv.FormatInt(int64(o.MaxAge.Seconds()), 10)
+
+	if o.IncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if o.Preload {
+		value += "; preload"
+	}
+
+	return value
+}
+
+// HSTS adds the Strict-Transport-Security header to the responses sent over
+// TLS; browsers ignore it on plain HTTP. A zero MaxAge disables it.
+func HSTS(options HSTSOptions) func(http.Handler) http.Handler {
+	header := options.header()
+
+	return func(next http.Handler) http.Handler {
+		if options.MaxAge <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil {
+				w.Header().Set("Strict-Transport-Security", header)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Port returns the port of a listen address such as ":5443".
+func Port(addr string) (string, error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("%q: %w", addr, err)
+	}
+	return port, nil
+}
@@ -0,0 +1,83 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		method, target, host, port string
+		wantStatus                 int
+		wantLocation               string
+	}{
+		{http.MethodGet, "/login?next=%2F", "example.com", "443", http.StatusMovedPermanently, "https://example.com/login?next=%2F"},
+		{http.MethodHead, "/", "example.com:8080", "", http.StatusMovedPermanently, "https://example.com/"},
+		{http.MethodGet, "/", "example.com:8080", "5443", http.StatusMovedPermanently, "https://example.com:5443/"},
+		{http.MethodPost, "/login", "example.com", "443", http.StatusPermanentRedirect, "https://example.com/login"},
+		{http.MethodGet, "/", "[::1]:8080", "443", http.StatusMovedPermanently, "https://[::1]/"},
+		{http.MethodGet, "/", "[::1]:8080", "5443", http.StatusMovedPermanently, "https://[::1]:5443/"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.target, nil)
+		request.Host = test.host
+		recorder := httptest.NewRecorder()
+
+		RedirectHandler(test.port).ServeHTTP(recorder, request)
+
+		if recorder.Code != test.wantStatus || recorder.Header().Get("Location") != test.wantLocation {
+			t.Errorf("%s %s%s = %d %q, want %d %q", test.method, test.host, test.target,
+				recorder.Code, recorder.Header().Get("Location"), test.wantStatus, test.wantLocation)
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Host = ""
+	recorder := httptest.NewRecorder()
+	RedirectHandler("443").ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("request without host = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	options := HSTSOptions{MaxAge: 365 * 24 * time.Hour, IncludeSubdomains: true, Preload: true}
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.TLS = &tls.ConnectionState{}
+	recorder := httptest.NewRecorder()
+	HSTS(options)(next).ServeHTTP(recorder, request)
+
+	if got, want := recorder.Header().Get("Strict-Transport-Security"), "max-age=31536000; includeSubDomains; preload"; got != want {
+		t.Errorf("header over TLS = %q, want %q", got, want)
+	}
+
+	recorder = httptest.NewRecorder()
+	HSTS(options)(next).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := recorder.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("header over plain HTTP = %q, want none", got)
+	}
+
+	recorder = httptest.NewRecorder()
+	HSTS(HSTSOptions{})(next).ServeHTTP(recorder, request)
+
+	if got := recorder.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("header with a zero max age = %q, want none", got)
+	}
+}
+
+func TestPort(t *testing.T) {
+	if port, err := Port(":5443"); err != nil || port != "5443" {
+		t.Errorf("Port(:5443) = %q, %v", port, err)
+	}
+	if _, err := Port("5443"); err == nil {
+		t.Error("Port(5443) succeeded")
+	}
+}
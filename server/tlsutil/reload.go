@@ -0,0 +1,121 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader serves a certificate and key pair read from files, reading
+// them again when either file changes so that renewed certificates are used
+// without restarting. A pair that fails to load is logged and the previous
+// one kept.
+type CertReloader struct {
+	certFile, keyFile string
+
+	mu           sync.RWMutex
+	certificate  *tls.Certificate
+	certModTime  time.Time
+	keyModTime   time.Time
+	stopWatching chan struct{}
+	stopOnce     sync.Once
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	reloader := &CertReloader{certFile: certFile, keyFile: keyFile, stopWatching: make(chan struct{})}
+
+	if _, err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.certificate == nil {
+		return nil, errNoCertificate
+	}
+	return c.certificate, nil
+}
+
+func modTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// reload loads the pair when a file changed since the last load, and
+// reports whether it did.
+func (c *CertReloader) reload() (bool, error) {
+	certModTime, err := modTime(c.certFile)
+	if err != nil {
+		return false, err
+	}
+
+	keyModTime, err := modTime(c.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.RLock()
+	unchanged := c.certificate != nil && certModTime.Equal(c.certModTime) && keyModTime.Equal(c.keyModTime)
+	c.mu.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	c.certificate = &certificate
+	c.certModTime = certModTime
+	c.keyModTime = keyModTime
+	c.mu.Unlock()
+
+	return true, nil
+}
+
+// Watch checks the files every interval until Stop is called.
+func (c *CertReloader) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stopWatching:
+				return
+			case <-ticker.C:
+			}
+
+			reloaded, err := c.reload()
+			if err != nil {
+				// the cert and key may be caught halfway through their
+				// renewal, the next check picks up the complete pair
+				slog.Error("TLS certificate reload failed, keeping the current one", "error", err)
+				continue
+			}
+
+			if reloaded {
+				slog.Info("TLS certificate reloaded", "file", c.certFile)
+			}
+		}
+	}()
+}
+
+func (c *CertReloader) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopWatching)
+	})
+}
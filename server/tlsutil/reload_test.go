@@ -0,0 +1,178 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert issues a certificate for 127.0.0.1 signed by parent, or
+// self-signed when parent is nil.
+func newTestCert(t *testing.T, commonName string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+
+	issuer, issuerKey := template, key
+	if parent != nil {
+		issuer, issuerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// writePair writes the pair of cert and sets the modification time of both
+// files to modTime, so that a rewrite within the same clock tick is seen.
+func writePair(t *testing.T, certFile, keyFile string, cert *testCert, modTime time.Time) {
+	t.Helper()
+
+	for path, data := range map[string][]byte{certFile: cert.certPEM, keyFile: cert.keyPEM} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func servedCommonName(t *testing.T, reloader *CertReloader) string {
+	t.Helper()
+
+	certificate, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloaderReloadsChangedPair(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+
+	writePair(t, certFile, keyFile, newTestCert(t, "first", nil, false), start)
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name := servedCommonName(t, reloader); name != "first" {
+		t.Fatalf("serving %q, want first", name)
+	}
+
+	if reloaded, err := reloader.reload(); reloaded || err != nil {
+		t.Errorf("reload of unchanged files = %v, %v, want false", reloaded, err)
+	}
+
+	writePair(t, certFile, keyFile, newTestCert(t, "second", nil, false), start.Add(time.Second))
+
+	if reloaded, err := reloader.reload(); !reloaded || err != nil {
+		t.Fatalf("reload of renewed files = %v, %v, want true", reloaded, err)
+	}
+
+	if name := servedCommonName(t, reloader); name != "second" {
+		t.Errorf("serving %q after the renewal, want second", name)
+	}
+}
+
+func TestCertReloaderKeepsPairOnMismatch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+
+	writePair(t, certFile, keyFile, newTestCert(t, "first", nil, false), start)
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the certificate is renewed before its key is
+	renewed := newTestCert(t, "second", nil, false)
+	if err = os.WriteFile(certFile, renewed.certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(certFile, start.Add(time.Second), start.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = reloader.reload(); err == nil {
+		t.Error("reload of a mismatched pair succeeded")
+	}
+
+	if name := servedCommonName(t, reloader); name != "first" {
+		t.Errorf("serving %q after a failed reload, want first", name)
+	}
+}
+
+func TestNewCertReloaderMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := NewCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")); err == nil {
+		t.Error("NewCertReloader succeeded without files")
+	}
+}
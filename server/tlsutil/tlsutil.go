@@ -0,0 +1,116 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"server/errs"
+)
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseVersion reads a TLS version written as "1.2" or "1.3".
+func ParseVersion(version string) (uint16, error) {
+	value, ok := versions[strings.TrimPrefix(strings.TrimSpace(version), "TLS")]
+	if !ok {
+		return 0, fmt.Errorf("%s: %q", errs.UnknownTLSVersionError, version)
+	}
+	return value, nil
+}
+
+// ParseCipherSuites returns the IDs of the cipher suites named as in
+// crypto/tls, such as TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. The suites
+// considered insecure by crypto/tls are refused. They only apply up to
+// TLS 1.2, the TLS 1.3 suites are not configurable.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("%s: %q", errs.UnknownCipherSuiteError, name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// LoadClientCAs reads the PEM certificates trusted to sign client
+// certificates.
+func LoadClientCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: %s", path, errs.NoCertificatesFoundError)
+	}
+
+	return pool, nil
+}
+
+type Options struct {
+	MinVersion   string
+	CipherSuites []string
+	// ClientCAFile enables client certificates: they are requested, and
+	// verified against these CAs when given. Handlers decide which routes
+	// require one, see HasVerifiedClientCert.
+	ClientCAFile string
+}
+
+// NewConfig builds the server TLS configuration, taking its certificate
+// from reloader on every handshake.
+func NewConfig(reloader *CertReloader, options Options) (*tls.Config, error) {
+	minVersion, err := ParseVersion(options.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	cipherSuites, err := ParseCipherSuites(options.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if options.ClientCAFile != "" {
+		if config.ClientCAs, err = LoadClientCAs(options.ClientCAFile); err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
+
+// HasVerifiedClientCert reports whether the connection of the request
+// presented a client certificate signed by one of the client CAs.
+func HasVerifiedClientCert(state *tls.ConnectionState) bool {
+	return state != nil && len(state.VerifiedChains) > 0
+}
+
+var errNoCertificate = errors.New(errs.NoCertificatesFoundError)
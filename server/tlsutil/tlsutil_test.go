@@ -0,0 +1,175 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := map[string]uint16{
+		"1.2":     tls.VersionTLS12,
+		" 1.3 ":   tls.VersionTLS13,
+		"TLS1.2":  tls.VersionTLS12,
+		"1.0":     tls.VersionTLS10,
+		"1.4":     0,
+		"":        0,
+		"SSL3.0":  0,
+		"TLS 1.3": 0,
+	}
+
+	for version, want := range tests {
+		got, err := ParseVersion(version)
+		if want == 0 {
+			if err == nil {
+				t.Errorf("ParseVersion(%q) = %x, want an error", version, got)
+			}
+			continue
+		}
+
+		if err != nil || got != want {
+			t.Errorf("ParseVersion(%q) = %x, %v, want %x", version, got, err, want)
+		}
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", " TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}
+	if len(ids) != len(want) || ids[0] != want[0] || ids[1] != want[1] {
+		t.Errorf("ParseCipherSuites = %x, want %x", ids, want)
+	}
+
+	if ids, err = ParseCipherSuites(nil); ids != nil || err != nil {
+		t.Errorf("ParseCipherSuites(nil) = %x, %v, want the defaults of crypto/tls", ids, err)
+	}
+
+	for _, name := range []string{"TLS_RSA_WITH_RC4_128_SHA", "TLS_RSA_WITH_3DES_EDE_CBC_SHA", "unknown"} {
+		if _, err = ParseCipherSuites([]string{name}); err == nil {
+			t.Errorf("ParseCipherSuites(%q) succeeded", name)
+		}
+	}
+}
+
+// TestNewConfigClientCertificates serves a TLS server and checks that only
+// the clients with a certificate of the client CA are verified.
+func TestNewConfigClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+
+	ca := newTestCert(t, "client ca", nil, true)
+	client := newTestCert(t, "client", ca, false)
+	stranger := newTestCert(t, "stranger", nil, false)
+	server := newTestCert(t, "server", nil, false)
+
+	writePair(t, certFile, keyFile, server, time.Now())
+	if err := os.WriteFile(caFile, ca.certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := NewConfig(reloader, Options{MinVersion: "1.2", ClientCAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if HasVerifiedClientCert(r.TLS) {
+			io.WriteString(w, "verified")
+		} else {
+			io.WriteString(w, "anonymous")
+		}
+	}))
+	// StartTLS would serve the certificate of httptest instead
+	ts.Listener = tls.NewListener(ts.Listener, config)
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.Start()
+	defer ts.Close()
+
+	url := "https://" + ts.Listener.Addr().String()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.cert)
+
+	get := func(clientCert *testCert) (string, error) {
+		clientConfig := &tls.Config{RootCAs: roots}
+		if clientCert != nil {
+			pair, err := tls.X509KeyPair(clientCert.certPEM, clientCert.keyPEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// sent even when its CA is not one the server asks for
+			clientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &pair, nil
+			}
+		}
+
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+		defer httpClient.CloseIdleConnections()
+
+		response, err := httpClient.Get(url)
+		if err != nil {
+			return "", err
+		}
+		defer response.Body.Close()
+
+		body, err := io.ReadAll(response.Body)
+		return string(body), err
+	}
+
+	if body, err := get(client); err != nil || body != "verified" {
+		t.Errorf("client of the CA: %q, %v, want verified", body, err)
+	}
+	if body, err := get(nil); err != nil || body != "anonymous" {
+		t.Errorf("client without certificate: %q, %v, want anonymous", body, err)
+	}
+	if _, err := get(stranger); err == nil {
+		t.Error("client with a certificate of another CA was let in")
+	}
+
+	if HasVerifiedClientCert(nil) {
+		t.Error("HasVerifiedClientCert(nil) = true")
+	}
+}
+
+func TestNewConfigRejectsBadOptions(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+
+	writePair(t, certFile, keyFile, newTestCert(t, "server", nil, false), time.Now())
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]Options{
+		"version":      {MinVersion: "2.0"},
+		"cipher suite": {MinVersion: "1.2", CipherSuites: []string{"unknown"}},
+		"client CAs":   {MinVersion: "1.2", ClientCAFile: caFile},
+	}
+
+	for name, options := range tests {
+		if _, err := NewConfig(reloader, options); err == nil {
+			t.Errorf("%s: NewConfig succeeded", name)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package utils
 
 import (
 	"net/mail"
-	"regexp"
 )
 
 func IsValidEmail(email string) bool {
@@ -10,13 +9,6 @@ func IsValidEmail(email string) bool {
 	return err == nil
 }
 
-func IsValidPhoneNumber(phone string) bool {
-	pattern := `^\d{10}$`
-	regExp := regexp.MustCompile(pattern)
-
-	return regExp.MatchString(phone)
-}
-
 func IsEmptyStr(str string) bool {
 	return len(str) == 0
 }